@@ -0,0 +1,165 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"time"
+)
+
+// Alignment controls how inputs without a sample at a given timestamp are valued
+type Alignment int
+
+const (
+	AlignHold   Alignment = iota // use the last value seen
+	AlignLinear                  // interpolate between the surrounding values
+)
+
+const (
+	// maxStaleness is how far an input may fall behind the newest one before
+	// it counts as stalled. A stalled input no longer holds back the output,
+	// its last value is used until it catches up.
+	maxStaleness = time.Minute
+
+	// maxAlignPending bounds the values buffered per input. Older values are
+	// consumed without waiting for the other inputs.
+	maxAlignPending = 10_000
+)
+
+// aligner merges several timestamp-ordered inputs. It only emits timestamps
+// that every live input has caught up to, so inputs may be fed in any order,
+// e.g. one whole history after another, as long as they stay within
+// maxStaleness and maxAlignPending of each other.
+type aligner struct {
+	mode    Alignment
+	pending [][]schema.Value // per input, not yet emitted
+	last    []*schema.Value  // per input, last value consumed
+	latest  []time.Time      // per input, latest timestamp seen
+	seen    []bool
+	scratch []float64
+
+	drained    time.Time // latest timestamp consumed, output never goes back before it
+	hasDrained bool
+}
+
+func newAligner(inputs int, mode Alignment) *aligner {
+	return &aligner{
+		mode:    mode,
+		pending: make([][]schema.Value, inputs),
+		last:    make([]*schema.Value, inputs),
+		latest:  make([]time.Time, inputs),
+		seen:    make([]bool, inputs),
+		scratch: make([]float64, inputs),
+	}
+}
+
+func (a *aligner) add(input int, values []schema.Value) {
+	for _, v := range values {
+		if a.seen[input] && !v.Timestamp.After(a.latest[input]) {
+			continue // out of order or duplicate
+		}
+		a.pending[input] = append(a.pending[input], v)
+		a.latest[input] = v.Timestamp
+		a.seen[input] = true
+	}
+}
+
+// watermark is the latest timestamp every live input has reached. Inputs
+// more than maxStaleness behind the newest are left out, inputs never seen
+// hold back everything.
+func (a *aligner) watermark() (time.Time, bool) {
+	var newest time.Time
+	for idx, t := range a.latest {
+		if !a.seen[idx] {
+			return time.Time{}, false
+		}
+		if idx == 0 || t.After(newest) {
+			newest = t
+		}
+	}
+
+	result := newest
+	stale := newest.Add(-maxStaleness)
+	for _, t := range a.latest {
+		if t.Before(result) && !t.Before(stale) {
+			result = t
+		}
+	}
+	return result, true
+}
+
+func (a *aligner) drain(fcn CombineFcn) []schema.Value {
+	wm, ok := a.watermark()
+
+	for _, p := range a.pending {
+		if len(p) > maxAlignPending {
+			t := p[len(p)-maxAlignPending-1].Timestamp
+			if !ok || t.After(wm) {
+				wm, ok = t, true
+			}
+		}
+	}
+
+	if !ok {
+		return nil
+	}
+
+	var result []schema.Value
+
+	for {
+		// next timestamp is the earliest pending head
+		var t time.Time
+		found := false
+		for _, p := range a.pending {
+			if len(p) > 0 && (!found || p[0].Timestamp.Before(t)) {
+				t = p[0].Timestamp
+				found = true
+			}
+		}
+		if !found || t.After(wm) {
+			break
+		}
+
+		for idx, p := range a.pending {
+			if len(p) > 0 && p[0].Timestamp.Equal(t) {
+				v := p[0]
+				a.last[idx] = &v
+				a.pending[idx] = p[1:]
+			}
+		}
+
+		// a stalled input catching up only updates its held value
+		if a.hasDrained && !t.After(a.drained) {
+			continue
+		}
+		a.drained, a.hasDrained = t, true
+
+		if v, ok := a.valuesAt(t); ok {
+			result = append(result, schema.Value{
+				Timestamp: t,
+				Value:     fcn(v),
+			})
+		}
+	}
+
+	return result
+}
+
+func (a *aligner) valuesAt(t time.Time) ([]float64, bool) {
+	for idx, last := range a.last {
+		if last == nil {
+			return nil, false
+		}
+
+		a.scratch[idx] = last.Value
+
+		if a.mode != AlignLinear || last.Timestamp.Equal(t) || len(a.pending[idx]) == 0 {
+			continue
+		}
+
+		next := a.pending[idx][0]
+		span := float64(next.Timestamp.Sub(last.Timestamp))
+		frac := float64(t.Sub(last.Timestamp)) / span
+		a.scratch[idx] = last.Value + frac*(next.Value-last.Value)
+	}
+
+	return a.scratch, true
+}
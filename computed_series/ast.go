@@ -0,0 +1,205 @@
+package computed_series
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseError reports a problem with an expression at a column, counted in runes from 1
+type ParseError struct {
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// Expr is a node of a parsed expression. String returns the canonical form,
+// which parses back to an equal tree.
+type Expr interface {
+	Pos() int
+	String() string
+	precedence() int
+}
+
+const (
+	precPipe = iota + 1
+	precAdditive
+	precMultiplicative
+	precUnary
+	precPrimary
+)
+
+// SeriesRef names an input series
+type SeriesRef struct {
+	Column int
+	Name   string
+}
+
+// NumberLit is a constant, optionally with a unit such as "30s"
+type NumberLit struct {
+	Column int
+	Value  float64
+	Unit   string
+}
+
+type UnaryExpr struct {
+	Column int
+	Op     string
+	X      Expr
+}
+
+type BinaryExpr struct {
+	Column int
+	Op     string
+	X      Expr
+	Y      Expr
+}
+
+// CallExpr is a combining function applied to sub-expressions, e.g. sum(a, b)
+type CallExpr struct {
+	Column int
+	Func   string
+	Args   []Expr
+}
+
+// PipeExpr passes the output of X through a function, e.g. x | avg 30s
+type PipeExpr struct {
+	Column int
+	X      Expr
+	Func   string
+	Args   []Arg
+}
+
+// Arg is a function argument in a pipeline stage. Name is empty for positional arguments.
+type Arg struct {
+	Column int
+	Name   string
+	Value  Literal
+}
+
+type LiteralKind int
+
+const (
+	LiteralNumber LiteralKind = iota
+	LiteralIdent
+	LiteralString
+)
+
+type Literal struct {
+	Kind  LiteralKind
+	Text  string // identifier or string contents
+	Value float64
+	Unit  string
+}
+
+func (s *SeriesRef) Pos() int  { return s.Column }
+func (n *NumberLit) Pos() int  { return n.Column }
+func (u *UnaryExpr) Pos() int  { return u.Column }
+func (b *BinaryExpr) Pos() int { return b.Column }
+func (c *CallExpr) Pos() int   { return c.Column }
+func (p *PipeExpr) Pos() int   { return p.Column }
+
+func (s *SeriesRef) precedence() int { return precPrimary }
+func (n *NumberLit) precedence() int { return precPrimary }
+func (u *UnaryExpr) precedence() int { return precUnary }
+func (c *CallExpr) precedence() int  { return precPrimary }
+func (p *PipeExpr) precedence() int  { return precPipe }
+
+func (b *BinaryExpr) precedence() int {
+	switch b.Op {
+	case "*", "/":
+		return precMultiplicative
+	}
+	return precAdditive
+}
+
+// isBareName reports whether s can be written without quotes
+func isBareName(s string) bool {
+	toks, err := tokenize(s)
+	return err == nil && len(toks) == 2 && toks[0].kind == tokIdent && toks[0].text == s
+}
+
+func quoteName(s string) string {
+	if isBareName(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+func formatNumber(v float64, unit string) string {
+	return strconv.FormatFloat(v, 'f', -1, 64) + unit
+}
+
+func (s *SeriesRef) String() string {
+	return quoteName(s.Name)
+}
+
+func (n *NumberLit) String() string {
+	return formatNumber(n.Value, n.Unit)
+}
+
+func wrap(e Expr, minPrec int) string {
+	if e.precedence() < minPrec {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+func (u *UnaryExpr) String() string {
+	return u.Op + wrap(u.X, precUnary)
+}
+
+func (b *BinaryExpr) String() string {
+	prec := b.precedence()
+	// operators are left associative, so an equal precedence right operand needs parentheses
+	return wrap(b.X, prec) + " " + b.Op + " " + wrap(b.Y, prec+1)
+}
+
+func (c *CallExpr) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = arg.String()
+	}
+	return c.Func + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (p *PipeExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString(wrap(p.X, precPipe))
+	sb.WriteString(" | ")
+	sb.WriteString(p.Func)
+	for _, arg := range p.Args {
+		sb.WriteString(" ")
+		sb.WriteString(arg.String())
+	}
+	return sb.String()
+}
+
+func (a Arg) String() string {
+	if a.Name == "" {
+		return a.Value.String()
+	}
+	return a.Name + "=" + a.Value.String()
+}
+
+func (l Literal) String() string {
+	switch l.Kind {
+	case LiteralNumber:
+		return formatNumber(l.Value, l.Unit)
+	case LiteralString:
+		return strconv.Quote(l.Text)
+	}
+	return l.Text
+}
+
+// Raw is the argument as a function receives it: numbers in canonical form,
+// identifiers and strings without quotes
+func (l Literal) Raw() string {
+	if l.Kind == LiteralNumber {
+		return formatNumber(l.Value, l.Unit)
+	}
+	return l.Text
+}
@@ -0,0 +1,56 @@
+package computed_series
+
+import "math"
+
+// CombineFcn reduces the aligned values of all inputs at one timestamp
+type CombineFcn func(values []float64) float64
+
+var binaryOperators = map[string]CombineFcn{
+	"+": func(v []float64) float64 { return v[0] + v[1] },
+	"-": func(v []float64) float64 { return v[0] - v[1] },
+	"*": func(v []float64) float64 { return v[0] * v[1] },
+	"/": func(v []float64) float64 { return v[0] / v[1] },
+}
+
+var combineFunctions = map[string]CombineFcn{
+	"sum": func(v []float64) float64 {
+		result := 0.0
+		for _, x := range v {
+			result += x
+		}
+		return result
+	},
+	"mean": func(v []float64) float64 {
+		result := 0.0
+		for _, x := range v {
+			result += x
+		}
+		return result / float64(len(v))
+	},
+	"product": func(v []float64) float64 {
+		result := 1.0
+		for _, x := range v {
+			result *= x
+		}
+		return result
+	},
+	"min": func(v []float64) float64 {
+		result := math.Inf(1)
+		for _, x := range v {
+			result = math.Min(result, x)
+		}
+		return result
+	},
+	"max": func(v []float64) float64 {
+		result := math.Inf(-1)
+		for _, x := range v {
+			result = math.Max(result, x)
+		}
+		return result
+	},
+}
+
+var alignments = map[string]Alignment{
+	"hold":   AlignHold,
+	"interp": AlignLinear,
+}
@@ -0,0 +1,125 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func values(points ...float64) []schema.Value {
+	// points are (seconds, value) pairs
+	var result []schema.Value
+	for i := 0; i < len(points); i += 2 {
+		result = append(result, schema.Value{
+			Timestamp: time.Unix(int64(points[i]), 0),
+			Value:     points[i+1],
+		})
+	}
+	return result
+}
+
+func TestCombine(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr   string
+		inputs []string
+		a, b   []schema.Value
+		want   []schema.Value
+	}{
+		{
+			expr:   "voltage * current",
+			inputs: []string{"voltage", "current"},
+			a:      values(0, 10, 2, 12, 4, 14),
+			b:      values(1, 2, 3, 3, 5, 4),
+			// output at every timestamp once both inputs have a value, up to the
+			// latest timestamp both inputs have reached
+			want: values(1, 20, 2, 24, 3, 36, 4, 42),
+		},
+		{
+			expr:   "interp(voltage - current)",
+			inputs: []string{"voltage", "current"},
+			a:      values(0, 10, 2, 12, 4, 14),
+			b:      values(1, 2, 3, 3, 5, 4),
+			want:   values(1, 9, 2, 9.5, 3, 10, 4, 10.5),
+		},
+		{
+			expr:   "sum(voltage, current) | add 1",
+			inputs: []string{"voltage", "current"},
+			a:      values(0, 1, 1, 2),
+			b:      values(0, 10, 1, 20),
+			want:   values(0, 12, 1, 23),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := p.ParseNode(tt.expr, time.Time{})
+			require.NoError(t, err)
+			require.Equal(t, tt.inputs, node.Inputs())
+
+			// feeding one whole input after the other must give the same
+			// result as interleaved live data
+			var got []schema.Value
+			got = append(got, node.Process("voltage", tt.a)...)
+			got = append(got, node.Process("current", tt.b)...)
+			require.Equal(t, tt.want, got)
+
+			node, err = p.ParseNode(tt.expr, time.Time{})
+			require.NoError(t, err)
+
+			got = nil
+			for i := range tt.a {
+				got = append(got, node.Process("current", tt.b[i:i+1])...)
+				got = append(got, node.Process("voltage", tt.a[i:i+1])...)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, bad := range []string{
+		"a % b",
+		"nope(a, b)",
+		"sum()",
+		"a b",
+	} {
+		_, err := p.ParseNode(bad, time.Time{})
+		require.Error(t, err, bad)
+	}
+}
+
+func TestCombineStalledInput(t *testing.T) {
+	p := NewParser()
+	node, err := p.ParseNode("a + b", time.Time{})
+	require.NoError(t, err)
+
+	// b stops after its first value, a carries on
+	var got []schema.Value
+	got = append(got, node.Process("b", values(0, 1))...)
+	for sec := 0; sec <= 300; sec++ {
+		got = append(got, node.Process("a", values(float64(sec), float64(sec)))...)
+	}
+
+	require.Len(t, got, 301)
+	require.Equal(t, values(300, 301), got[len(got)-1:])
+	require.Empty(t, node.(*CombineNode).align.pending[0])
+
+	// b resuming late changes the held value without going back in time,
+	// after that the output waits for it again
+	require.Empty(t, node.Process("b", values(250, 5)))
+	require.Empty(t, node.Process("a", values(301, 301)))
+	require.Equal(t, values(301, 306), node.Process("b", values(302, 5)))
+}
+
+func TestCombinePendingBound(t *testing.T) {
+	p := NewParser()
+	node, err := p.ParseNode("a + b", time.Time{})
+	require.NoError(t, err)
+
+	// b never shows up
+	for sec := 0; sec < 3*maxAlignPending; sec++ {
+		require.Empty(t, node.Process("a", values(float64(sec), 1)))
+	}
+	require.Len(t, node.(*CombineNode).align.pending[0], maxAlignPending)
+}
@@ -17,6 +17,8 @@ func (cs *ComputedSeries) Lookback() time.Duration {
 	return cs.duration
 }
 
+// NewComputedSeries drops output before start, a zero start keeps everything.
+// The parser passes zero since it applies start to the whole expression.
 func NewComputedSeries(
 	fcn Fcn,
 	duration time.Duration,
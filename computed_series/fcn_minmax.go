@@ -0,0 +1,55 @@
+package computed_series
+
+import (
+	"github.com/gammazero/deque"
+	"github.com/minor-industries/rtgraph/schema"
+)
+
+type seqValue struct {
+	seq   uint64
+	value float64
+}
+
+// FcnExtreme is a rolling min or max. It keeps a monotonic deque of the
+// values that can still become the extreme, so each value is pushed and
+// popped at most once.
+type FcnExtreme struct {
+	max     bool
+	added   uint64
+	removed uint64
+	window  deque.Deque[seqValue]
+}
+
+func NewFcnMin() *FcnExtreme { return &FcnExtreme{} }
+func NewFcnMax() *FcnExtreme { return &FcnExtreme{max: true} }
+
+// dominates reports whether a new value a makes an older value b irrelevant
+func (f *FcnExtreme) dominates(a, b float64) bool {
+	if f.max {
+		return a >= b
+	}
+	return a <= b
+}
+
+func (f *FcnExtreme) AddValue(v schema.Value) {
+	for f.window.Len() > 0 && f.dominates(v.Value, f.window.Back().value) {
+		f.window.PopBack()
+	}
+	f.window.PushBack(seqValue{seq: f.added, value: v.Value})
+	f.added++
+}
+
+// RemoveValue relies on values being removed in the order they were added
+func (f *FcnExtreme) RemoveValue(v schema.Value) {
+	if f.window.Len() > 0 && f.window.Front().seq == f.removed {
+		f.window.PopFront()
+	}
+	f.removed++
+}
+
+func (f *FcnExtreme) Compute(_ *deque.Deque[schema.Value]) (float64, bool) {
+	if f.window.Len() == 0 {
+		return 0, false
+	}
+	return f.window.Front().value, true
+}
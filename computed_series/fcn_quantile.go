@@ -0,0 +1,178 @@
+package computed_series
+
+import (
+	"container/heap"
+	"github.com/gammazero/deque"
+	"github.com/minor-industries/rtgraph/schema"
+	"math"
+)
+
+// FcnQuantile is a rolling quantile using two heaps: low holds the smallest
+// values up to the wanted rank, high holds the rest. Removed values are
+// deleted lazily once they reach the top of their heap.
+type FcnQuantile struct {
+	q float64 // 0..1, 0.5 is the median
+
+	low  valueHeap // max-heap
+	high valueHeap // min-heap
+
+	inLow     map[uint64]bool // live values by sequence number, and which heap they are in
+	deleted   map[uint64]bool
+	lowCount  int // live values in low
+	highCount int // live values in high
+
+	added   uint64
+	removed uint64
+}
+
+func NewFcnQuantile(q float64) *FcnQuantile {
+	return &FcnQuantile{
+		q:       q,
+		low:     valueHeap{max: true},
+		inLow:   map[uint64]bool{},
+		deleted: map[uint64]bool{},
+	}
+}
+
+func (f *FcnQuantile) AddValue(v schema.Value) {
+	sv := seqValue{seq: f.added, value: v.Value}
+	f.added++
+
+	if f.lowCount > 0 && v.Value <= f.low.top().value {
+		heap.Push(&f.low, sv)
+		f.inLow[sv.seq] = true
+		f.lowCount++
+	} else {
+		heap.Push(&f.high, sv)
+		f.inLow[sv.seq] = false
+		f.highCount++
+	}
+
+	f.rebalance()
+}
+
+// RemoveValue relies on values being removed in the order they were added
+func (f *FcnQuantile) RemoveValue(v schema.Value) {
+	seq := f.removed
+	f.removed++
+
+	low, ok := f.inLow[seq]
+	if !ok {
+		return
+	}
+	delete(f.inLow, seq)
+	f.deleted[seq] = true
+
+	if low {
+		f.lowCount--
+	} else {
+		f.highCount--
+	}
+
+	f.rebalance()
+	f.compact()
+}
+
+func (f *FcnQuantile) prune(h *valueHeap) {
+	for h.Len() > 0 && f.deleted[h.top().seq] {
+		delete(f.deleted, h.top().seq)
+		heap.Pop(h)
+	}
+}
+
+// rank is the index, counting from zero, of the lower value that the quantile interpolates from
+func (f *FcnQuantile) rank() (int, float64) {
+	n := f.lowCount + f.highCount
+	pos := f.q * float64(n-1)
+	idx := math.Floor(pos)
+	return int(idx), pos - idx
+}
+
+func (f *FcnQuantile) rebalance() {
+	f.prune(&f.low)
+	f.prune(&f.high)
+
+	if f.lowCount+f.highCount == 0 {
+		return
+	}
+
+	idx, _ := f.rank()
+	want := idx + 1
+
+	for f.lowCount > want {
+		sv := heap.Pop(&f.low).(seqValue)
+		heap.Push(&f.high, sv)
+		f.inLow[sv.seq] = false
+		f.lowCount--
+		f.highCount++
+		f.prune(&f.low)
+	}
+
+	for f.lowCount < want {
+		sv := heap.Pop(&f.high).(seqValue)
+		heap.Push(&f.low, sv)
+		f.inLow[sv.seq] = true
+		f.lowCount++
+		f.highCount--
+		f.prune(&f.high)
+	}
+}
+
+// compact drops deleted values buried in the heaps once they outnumber live ones
+func (f *FcnQuantile) compact() {
+	if len(f.deleted) <= f.lowCount+f.highCount+64 {
+		return
+	}
+
+	for _, h := range []*valueHeap{&f.low, &f.high} {
+		live := h.values[:0]
+		for _, sv := range h.values {
+			if !f.deleted[sv.seq] {
+				live = append(live, sv)
+			}
+		}
+		h.values = live
+		heap.Init(h)
+	}
+
+	clear(f.deleted)
+}
+
+func (f *FcnQuantile) Compute(_ *deque.Deque[schema.Value]) (float64, bool) {
+	if f.lowCount == 0 {
+		return 0, false
+	}
+
+	lo := f.low.top().value
+	_, frac := f.rank()
+	if frac == 0 || f.highCount == 0 {
+		return lo, true
+	}
+
+	hi := f.high.top().value
+	return lo + frac*(hi-lo), true
+}
+
+type valueHeap struct {
+	max    bool
+	values []seqValue
+}
+
+func (h *valueHeap) top() seqValue { return h.values[0] }
+func (h *valueHeap) Len() int      { return len(h.values) }
+func (h *valueHeap) Swap(i, j int) { h.values[i], h.values[j] = h.values[j], h.values[i] }
+func (h *valueHeap) Push(x any)    { h.values = append(h.values, x.(seqValue)) }
+
+func (h *valueHeap) Less(i, j int) bool {
+	if h.max {
+		return h.values[i].value > h.values[j].value
+	}
+	return h.values[i].value < h.values[j].value
+}
+
+func (h *valueHeap) Pop() any {
+	n := len(h.values)
+	x := h.values[n-1]
+	h.values = h.values[:n-1]
+	return x
+}
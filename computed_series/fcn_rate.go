@@ -0,0 +1,155 @@
+package computed_series
+
+import (
+	"github.com/gammazero/deque"
+	"github.com/minor-industries/rtgraph/schema"
+	"time"
+)
+
+// counterIncrease is the increase from prev to cur. A drop means the counter
+// was reset, so it restarted from zero and cur is all new.
+func counterIncrease(prev, cur schema.Value) float64 {
+	if cur.Value < prev.Value {
+		return cur.Value
+	}
+	return cur.Value - prev.Value
+}
+
+// FcnPairSum sums a quantity over every pair of consecutive values in the
+// window. Pairs are dropped along with their older value, which works because
+// ComputedSeries adds a value before removing any that fell out of the window.
+type FcnPairSum struct {
+	pair   func(prev, cur schema.Value) float64
+	result func(sum float64, values *deque.Deque[schema.Value]) (float64, bool)
+
+	pairs   deque.Deque[float64]
+	sum     float64
+	last    schema.Value
+	hasLast bool
+}
+
+func (f *FcnPairSum) AddValue(v schema.Value) {
+	if f.hasLast {
+		x := f.pair(f.last, v)
+		f.pairs.PushBack(x)
+		f.sum += x
+	}
+	f.last = v
+	f.hasLast = true
+}
+
+func (f *FcnPairSum) RemoveValue(v schema.Value) {
+	if f.pairs.Len() > 0 {
+		f.sum -= f.pairs.PopFront()
+	}
+}
+
+func (f *FcnPairSum) Compute(values *deque.Deque[schema.Value]) (float64, bool) {
+	if f.pairs.Len() == 0 {
+		return 0, false
+	}
+	if f.result == nil {
+		return f.sum, true
+	}
+	return f.result(f.sum, values)
+}
+
+// NewFcnIncrease is the counter increase over the window
+func NewFcnIncrease() *FcnPairSum {
+	return &FcnPairSum{pair: counterIncrease}
+}
+
+// NewFcnRate is the per-second counter increase between the first and last value in the window
+func NewFcnRate() *FcnPairSum {
+	return &FcnPairSum{
+		pair: counterIncrease,
+		result: func(sum float64, values *deque.Deque[schema.Value]) (float64, bool) {
+			span := values.Back().Timestamp.Sub(values.Front().Timestamp).Seconds()
+			if span <= 0 {
+				return 0, false
+			}
+			return sum / span, true
+		},
+	}
+}
+
+// NewFcnIntegral is the trapezoidal integral over the window, with time measured in unit
+func NewFcnIntegral(unit time.Duration) *FcnPairSum {
+	return &FcnPairSum{
+		pair: func(prev, cur schema.Value) float64 {
+			dt := float64(cur.Timestamp.Sub(prev.Timestamp)) / float64(unit)
+			return (prev.Value + cur.Value) / 2 * dt
+		},
+	}
+}
+
+// FcnDelta is the difference between the last and first value in the window, for gauges
+type FcnDelta struct{}
+
+func (f *FcnDelta) AddValue(v schema.Value) {}
+
+func (f *FcnDelta) RemoveValue(v schema.Value) {}
+
+func (f *FcnDelta) Compute(values *deque.Deque[schema.Value]) (float64, bool) {
+	if values.Len() < 2 {
+		return 0, false
+	}
+	return values.Back().Value - values.Front().Value, true
+}
+
+// FcnDeriv is the per-second slope of a least squares fit over the window.
+// Means and co-moments are updated incrementally in the style of Welford.
+type FcnDeriv struct {
+	ref    time.Time
+	hasRef bool
+
+	count int
+	meanT float64
+	meanV float64
+	covTV float64
+	varT  float64
+}
+
+func (f *FcnDeriv) seconds(ts time.Time) float64 {
+	if !f.hasRef {
+		f.ref = ts
+		f.hasRef = true
+	}
+	return ts.Sub(f.ref).Seconds()
+}
+
+func (f *FcnDeriv) AddValue(v schema.Value) {
+	t := f.seconds(v.Timestamp)
+
+	f.count++
+	dt := t - f.meanT
+	f.meanT += dt / float64(f.count)
+	f.meanV += (v.Value - f.meanV) / float64(f.count)
+	f.covTV += dt * (v.Value - f.meanV)
+	f.varT += dt * (t - f.meanT)
+}
+
+func (f *FcnDeriv) RemoveValue(v schema.Value) {
+	if f.count <= 1 {
+		*f = FcnDeriv{ref: f.ref, hasRef: f.hasRef}
+		return
+	}
+
+	t := f.seconds(v.Timestamp)
+
+	// undo AddValue: the co-moments grew by (x - old mean) * (y - new mean)
+	meanV := f.meanV
+	meanT := f.meanT
+	f.count--
+	f.meanT -= (t - f.meanT) / float64(f.count)
+	f.meanV -= (v.Value - f.meanV) / float64(f.count)
+	f.covTV -= (t - f.meanT) * (v.Value - meanV)
+	f.varT -= (t - f.meanT) * (t - meanT)
+}
+
+func (f *FcnDeriv) Compute(_ *deque.Deque[schema.Value]) (float64, bool) {
+	if f.count < 2 || f.varT <= 0 {
+		return 0, false
+	}
+	return f.covTV / f.varT, true
+}
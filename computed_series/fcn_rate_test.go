@@ -0,0 +1,69 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestCounterFunctions(t *testing.T) {
+	p := NewParser()
+
+	// a counter that resets to 0 and climbs again
+	input := values(
+		0, 10,
+		10, 20,
+		20, 35,
+		30, 5, // reset
+		40, 15,
+		50, 15,
+	)
+
+	tests := []struct {
+		expr string
+		want []schema.Value
+	}{
+		{"c | increase 1h", values(10, 10, 20, 25, 30, 30, 40, 40, 50, 40)},
+		{"c | increase 15s", values(10, 10, 20, 15, 30, 5, 40, 10, 50, 0)},
+		{"c | rate 1h", values(10, 1, 20, 1.25, 30, 1, 40, 1, 50, 0.8)},
+		{"c | delta 1h", values(10, 10, 20, 25, 30, -5, 40, 5, 50, 5)},
+		{"c | integral 15s", values(10, 150, 20, 275, 30, 200, 40, 100, 50, 150)},
+		{"c | integral 15s unit=10s", values(10, 15, 20, 27.5, 30, 20, 40, 10, 50, 15)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := p.ParseNode(tt.expr, time.Time{})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, node.Process("c", input))
+		})
+	}
+}
+
+func TestDeriv(t *testing.T) {
+	p := NewParser()
+
+	node, err := p.ParseNode("x | deriv 30s", time.Time{})
+	require.NoError(t, err)
+
+	// noisy line with slope 0.5 per second, then slope -2
+	rnd := rand.New(rand.NewSource(1))
+	var input []schema.Value
+	for i := 0; i < 600; i++ {
+		slope, offset := 0.5, 0.0
+		if i >= 300 {
+			slope, offset = -2, 750
+		}
+		input = append(input, schema.Value{
+			Timestamp: time.Unix(int64(i), 0),
+			Value:     slope*float64(i) + offset + rnd.Float64()*0.01,
+		})
+	}
+
+	got := node.Process("x", input)
+	require.Len(t, got, len(input)-1)
+	require.InDelta(t, 0.5, got[250].Value, 0.01)
+	require.InDelta(t, -2, got[len(got)-1].Value, 0.01)
+}
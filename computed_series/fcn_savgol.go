@@ -0,0 +1,110 @@
+package computed_series
+
+import (
+	"github.com/gammazero/deque"
+	"github.com/minor-industries/rtgraph/schema"
+	"math"
+	"time"
+)
+
+// FcnSavGol is a causal Savitzky–Golay smoother: a least squares polynomial
+// fit over the trailing window, evaluated at the newest value. Fitting actual
+// timestamps instead of sample indexes handles irregular spacing. It follows
+// trends with less lag than a moving average of the same window.
+type FcnSavGol struct {
+	duration time.Duration
+	order    int
+}
+
+func (f *FcnSavGol) AddValue(v schema.Value) {}
+
+func (f *FcnSavGol) RemoveValue(v schema.Value) {}
+
+func (f *FcnSavGol) Compute(values *deque.Deque[schema.Value]) (float64, bool) {
+	n := values.Len()
+	if n == 0 {
+		return 0, false
+	}
+
+	// a fit needs more points than coefficients
+	order := min(f.order, n-1)
+	size := order + 1
+
+	// normal equations in time relative to the newest value, in units of the
+	// window, which keeps the matrix well conditioned
+	now := values.Back().Timestamp
+	scale := float64(f.duration)
+
+	a := make([]float64, size*size)
+	b := make([]float64, size)
+	powers := make([]float64, 2*size-1)
+
+	for i := 0; i < n; i++ {
+		v := values.At(i)
+		t := float64(v.Timestamp.Sub(now)) / scale
+
+		p := 1.0
+		for k := range powers {
+			powers[k] += p
+			if k < size {
+				b[k] += p * v.Value
+			}
+			p *= t
+		}
+	}
+
+	for row := 0; row < size; row++ {
+		for col := 0; col < size; col++ {
+			a[row*size+col] = powers[row+col]
+		}
+	}
+
+	coeffs, ok := solve(a, b, size)
+	if !ok {
+		return values.Back().Value, true
+	}
+
+	// evaluated at t = 0 only the constant term is left
+	return coeffs[0], true
+}
+
+// solve solves the size x size system a x = b by Gaussian elimination with partial pivoting
+func solve(a, b []float64, size int) ([]float64, bool) {
+	for col := 0; col < size; col++ {
+		pivot := col
+		for row := col + 1; row < size; row++ {
+			if math.Abs(a[row*size+col]) > math.Abs(a[pivot*size+col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot*size+col]) < 1e-12 {
+			return nil, false
+		}
+
+		if pivot != col {
+			for k := 0; k < size; k++ {
+				a[col*size+k], a[pivot*size+k] = a[pivot*size+k], a[col*size+k]
+			}
+			b[col], b[pivot] = b[pivot], b[col]
+		}
+
+		for row := col + 1; row < size; row++ {
+			factor := a[row*size+col] / a[col*size+col]
+			for k := col; k < size; k++ {
+				a[row*size+k] -= factor * a[col*size+k]
+			}
+			b[row] -= factor * b[col]
+		}
+	}
+
+	x := make([]float64, size)
+	for row := size - 1; row >= 0; row-- {
+		sum := b[row]
+		for k := row + 1; k < size; k++ {
+			sum -= a[row*size+k] * x[k]
+		}
+		x[row] = sum / a[row*size+row]
+	}
+
+	return x, true
+}
@@ -0,0 +1,87 @@
+package computed_series
+
+import (
+	"github.com/gammazero/deque"
+	"github.com/minor-industries/rtgraph/schema"
+	"math"
+)
+
+// FcnVariance is the rolling population variance, or standard deviation when
+// stddev is set, kept up to date with Welford's algorithm
+type FcnVariance struct {
+	stddev bool
+	count  int
+	mean   float64
+	m2     float64
+}
+
+func (f *FcnVariance) AddValue(v schema.Value) {
+	f.count++
+	d := v.Value - f.mean
+	f.mean += d / float64(f.count)
+	f.m2 += d * (v.Value - f.mean)
+}
+
+func (f *FcnVariance) RemoveValue(v schema.Value) {
+	if f.count <= 1 {
+		*f = FcnVariance{stddev: f.stddev}
+		return
+	}
+	f.count--
+	d := v.Value - f.mean
+	f.mean -= d / float64(f.count)
+	f.m2 -= d * (v.Value - f.mean)
+}
+
+func (f *FcnVariance) Compute(_ *deque.Deque[schema.Value]) (float64, bool) {
+	if f.count <= 0 {
+		return 0, false
+	}
+
+	variance := max(f.m2, 0) / float64(f.count) // rounding can leave m2 slightly negative
+	if f.stddev {
+		return math.Sqrt(variance), true
+	}
+	return variance, true
+}
+
+type FcnCount struct {
+	count int
+}
+
+func (f *FcnCount) AddValue(v schema.Value) {
+	f.count++
+}
+
+func (f *FcnCount) RemoveValue(v schema.Value) {
+	f.count--
+}
+
+func (f *FcnCount) Compute(_ *deque.Deque[schema.Value]) (float64, bool) {
+	if f.count <= 0 {
+		return 0, false
+	}
+	return float64(f.count), true
+}
+
+type FcnSum struct {
+	count int
+	sum   float64
+}
+
+func (f *FcnSum) AddValue(v schema.Value) {
+	f.count++
+	f.sum += v.Value
+}
+
+func (f *FcnSum) RemoveValue(v schema.Value) {
+	f.count--
+	f.sum -= v.Value
+}
+
+func (f *FcnSum) Compute(_ *deque.Deque[schema.Value]) (float64, bool) {
+	if f.count <= 0 {
+		return 0, false
+	}
+	return f.sum, true
+}
@@ -0,0 +1,123 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+func naiveQuantile(q float64) func([]float64) float64 {
+	return func(xs []float64) float64 {
+		sorted := slices.Clone(xs)
+		slices.Sort(sorted)
+		pos := q * float64(len(sorted)-1)
+		lo := math.Floor(pos)
+		if int(lo)+1 >= len(sorted) {
+			return sorted[int(lo)]
+		}
+		return sorted[int(lo)] + (pos-lo)*(sorted[int(lo)+1]-sorted[int(lo)])
+	}
+}
+
+func naiveVariance(xs []float64) float64 {
+	mean := 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	result := 0.0
+	for _, x := range xs {
+		result += (x - mean) * (x - mean)
+	}
+	return result / float64(len(xs))
+}
+
+// each window function must match recomputing from scratch over the same window
+func TestWindowFunctions(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr  string
+		naive func([]float64) float64
+	}{
+		{"x | min 10s", slices.Min[[]float64]},
+		{"x | max 10s", slices.Max[[]float64]},
+		{"x | median 10s", naiveQuantile(0.5)},
+		{"x | p90 10s", naiveQuantile(0.9)},
+		{"x | p0 10s", naiveQuantile(0)},
+		{"x | p100 10s", naiveQuantile(1)},
+		{"x | percentile 10s 12.5", naiveQuantile(0.125)},
+		{"x | variance 10s", naiveVariance},
+		{"x | stddev 10s", func(xs []float64) float64 { return math.Sqrt(naiveVariance(xs)) }},
+		{"x | count 10s", func(xs []float64) float64 { return float64(len(xs)) }},
+		{"x | sum 10s", func(xs []float64) float64 {
+			result := 0.0
+			for _, x := range xs {
+				result += x
+			}
+			return result
+		}},
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	var input []schema.Value
+	ts := time.Unix(0, 0)
+	for i := 0; i < 2000; i++ {
+		// irregular spacing so the window size varies, with repeated values
+		ts = ts.Add(time.Duration(rnd.Intn(1500)) * time.Millisecond)
+		input = append(input, schema.Value{Timestamp: ts, Value: float64(rnd.Intn(20))})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := p.ParseNode(tt.expr, time.Time{})
+			require.NoError(t, err)
+
+			got := node.Process("x", input)
+			require.Len(t, got, len(input))
+
+			for i, v := range got {
+				cutoff := input[i].Timestamp.Add(-10 * time.Second)
+				var window []float64
+				for _, in := range input[:i+1] {
+					if !in.Timestamp.Before(cutoff) {
+						window = append(window, in.Value)
+					}
+				}
+				require.InDelta(t, tt.naive(window), v.Value, 1e-6, "index %d", i)
+			}
+		})
+	}
+}
+
+func TestPercentileNames(t *testing.T) {
+	p := NewParser()
+
+	for _, expr := range []string{"x | p101 1m", "x | percentile 1m 101", "x | pfoo 1m"} {
+		_, err := p.ParseNode(expr, time.Time{})
+		require.Error(t, err, expr)
+	}
+
+	_, err := p.ParseNode("x | p99.9 1m", time.Time{})
+	require.NoError(t, err)
+}
+
+func TestComputedSeriesStart(t *testing.T) {
+	cs := NewComputedSeries(&FcnSum{}, time.Minute, time.Unix(10, 0))
+
+	out := cs.ProcessNewValues([]schema.Value{
+		{Timestamp: time.Unix(5, 0), Value: 1},
+		{Timestamp: time.Unix(10, 0), Value: 2},
+		{Timestamp: time.Unix(15, 0), Value: 3},
+	})
+
+	// values before start still count towards the window
+	require.Equal(t, []schema.Value{
+		{Timestamp: time.Unix(10, 0), Value: 3},
+		{Timestamp: time.Unix(15, 0), Value: 6},
+	}, out)
+}
@@ -0,0 +1,259 @@
+package computed_series
+
+import "fmt"
+
+// Grammar, loosest binding first:
+//
+//	pipeline = additive { "|" stage }
+//	stage    = name { arg }
+//	arg      = [ name "=" ] ( number | "-" number | name | string )
+//	additive = term { ( "+" | "-" ) term }
+//	term     = unary { ( "*" | "/" ) unary }
+//	unary    = "-" unary | primary
+//	primary  = number | string | name | name "(" [ pipeline { "," pipeline } ] ")" | "(" pipeline ")"
+//
+// A string in a primary is a quoted series name.
+
+// ParseExpr parses an expression into its syntax tree without resolving any functions
+func ParseExpr(s string) (Expr, error) {
+	toks, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if toks[0].kind == tokEOF {
+		return nil, &ParseError{Column: 1, Msg: "empty expression"}
+	}
+
+	p := &exprParser{toks: toks}
+	expr, err := p.pipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.unexpected(tok, "")
+	}
+
+	return expr, nil
+}
+
+type exprParser struct {
+	toks []token
+	pos  int
+}
+
+func (p *exprParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *exprParser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+offset]
+}
+
+func (p *exprParser) next() token {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) expect(kind tokenKind) (token, error) {
+	tok := p.peek()
+	if tok.kind != kind {
+		return tok, p.unexpected(tok, kind.String())
+	}
+	return p.next(), nil
+}
+
+func (p *exprParser) unexpected(tok token, expected string) error {
+	msg := "unexpected " + tok.describe()
+	if expected != "" {
+		msg = fmt.Sprintf("expected %s, found %s", expected, tok.describe())
+	}
+	return &ParseError{Column: tok.column, Msg: msg}
+}
+
+func (p *exprParser) pipeline() (Expr, error) {
+	x, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokPipe {
+		p.next()
+
+		name, err := p.expect(tokIdent)
+		if err != nil {
+			return nil, err
+		}
+
+		pipe := &PipeExpr{Column: name.column, X: x, Func: name.text}
+		for {
+			arg, ok, err := p.arg()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			pipe.Args = append(pipe.Args, arg)
+		}
+
+		x = pipe
+	}
+
+	return x, nil
+}
+
+func (p *exprParser) arg() (Arg, bool, error) {
+	tok := p.peek()
+	arg := Arg{Column: tok.column}
+
+	if tok.kind == tokIdent && p.peekAt(1).kind == tokEquals {
+		arg.Name = tok.text
+		p.next()
+		p.next()
+		tok = p.peek()
+	}
+
+	switch {
+	case tok.kind == tokNumber:
+		arg.Value = Literal{Kind: LiteralNumber, Value: tok.value, Unit: tok.unit}
+	case tok.kind == tokMinus && p.peekAt(1).kind == tokNumber:
+		p.next()
+		num := p.peek()
+		arg.Value = Literal{Kind: LiteralNumber, Value: -num.value, Unit: num.unit}
+	case tok.kind == tokIdent:
+		arg.Value = Literal{Kind: LiteralIdent, Text: tok.text}
+	case tok.kind == tokString:
+		arg.Value = Literal{Kind: LiteralString, Text: tok.text}
+	case arg.Name != "":
+		return Arg{}, false, p.unexpected(tok, "argument value")
+	default:
+		// anything else ends the stage
+		return Arg{}, false, nil
+	}
+
+	p.next()
+	return arg, true, nil
+}
+
+func (p *exprParser) additive() (Expr, error) {
+	x, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		if tok.kind != tokPlus && tok.kind != tokMinus {
+			return x, nil
+		}
+		p.next()
+
+		y, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Column: tok.column, Op: tok.text, X: x, Y: y}
+	}
+}
+
+func (p *exprParser) term() (Expr, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		if tok.kind != tokStar && tok.kind != tokSlash {
+			return x, nil
+		}
+		p.next()
+
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Column: tok.column, Op: tok.text, X: x, Y: y}
+	}
+}
+
+func (p *exprParser) unary() (Expr, error) {
+	tok := p.peek()
+	if tok.kind != tokMinus {
+		return p.primary()
+	}
+	p.next()
+
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpr{Column: tok.column, Op: "-", X: x}, nil
+}
+
+func (p *exprParser) primary() (Expr, error) {
+	tok := p.peek()
+
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		return &NumberLit{Column: tok.column, Value: tok.value, Unit: tok.unit}, nil
+
+	case tokString:
+		p.next()
+		return &SeriesRef{Column: tok.column, Name: tok.text}, nil
+
+	case tokIdent:
+		p.next()
+		if p.peek().kind != tokLParen {
+			return &SeriesRef{Column: tok.column, Name: tok.text}, nil
+		}
+		p.next()
+
+		call := &CallExpr{Column: tok.column, Func: tok.text}
+		if p.peek().kind == tokRParen {
+			p.next()
+			return call, nil
+		}
+
+		for {
+			arg, err := p.pipeline()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+
+			sep := p.peek()
+			switch sep.kind {
+			case tokComma:
+				p.next()
+				continue
+			case tokRParen:
+				p.next()
+				return call, nil
+			}
+			return nil, p.unexpected(sep, `"," or ")"`)
+		}
+
+	case tokLParen:
+		p.next()
+		x, err := p.pipeline()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+
+	return nil, p.unexpected(tok, `series, number or "("`)
+}
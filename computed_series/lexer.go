@@ -0,0 +1,227 @@
+package computed_series
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokPipe
+	tokLParen
+	tokRParen
+	tokComma
+	tokEquals
+	tokPlus
+	tokMinus
+	tokStar
+	tokSlash
+)
+
+var tokenNames = map[tokenKind]string{
+	tokEOF:    "end of expression",
+	tokIdent:  "name",
+	tokNumber: "number",
+	tokString: "string",
+	tokPipe:   `"|"`,
+	tokLParen: `"("`,
+	tokRParen: `")"`,
+	tokComma:  `","`,
+	tokEquals: `"="`,
+	tokPlus:   `"+"`,
+	tokMinus:  `"-"`,
+	tokStar:   `"*"`,
+	tokSlash:  `"/"`,
+}
+
+func (k tokenKind) String() string {
+	return tokenNames[k]
+}
+
+type token struct {
+	kind   tokenKind
+	text   string // identifier name, unquoted string, or number as written
+	column int    // 1-based, in runes
+
+	// numbers only
+	value float64
+	unit  string
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokIdent, tokNumber:
+		return strconv.Quote(t.text)
+	case tokString:
+		return "string " + strconv.Quote(t.text)
+	}
+	return t.kind.String()
+}
+
+var punctuation = map[rune]tokenKind{
+	'|': tokPipe,
+	'(': tokLParen,
+	')': tokRParen,
+	',': tokComma,
+	'=': tokEquals,
+	'+': tokPlus,
+	'-': tokMinus,
+	'*': tokStar,
+	'/': tokSlash,
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentChar(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || r == '.' || r == ':'
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+type lexer struct {
+	src    []rune
+	pos    int
+	tokens []token
+}
+
+func tokenize(s string) ([]token, error) {
+	l := &lexer{src: []rune(s)}
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		l.tokens = append(l.tokens, tok)
+		if tok.kind == tokEOF {
+			return l.tokens, nil
+		}
+	}
+}
+
+func (l *lexer) peek(offset int) rune {
+	if l.pos+offset >= len(l.src) {
+		return utf8.RuneError
+	}
+	return l.src[l.pos+offset]
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(l.src[l.pos]) {
+		l.pos++
+	}
+
+	start := l.pos
+	column := start + 1
+
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, column: column}, nil
+	}
+
+	r := l.src[l.pos]
+
+	switch {
+	case isIdentStart(r):
+		// "-" joins words so that names like zone-1 keep working,
+		// subtraction needs spaces around the operator
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if isIdentChar(c) || (c == '-' && isIdentChar(l.peek(1))) {
+				l.pos++
+				continue
+			}
+			break
+		}
+		return token{kind: tokIdent, text: string(l.src[start:l.pos]), column: column}, nil
+
+	case isDigit(r) || (r == '.' && isDigit(l.peek(1))):
+		return l.number(column)
+
+	case r == '"' || r == '\'':
+		return l.string(column, r)
+	}
+
+	if kind, ok := punctuation[r]; ok {
+		l.pos++
+		return token{kind: kind, text: string(r), column: column}, nil
+	}
+
+	return token{}, &ParseError{Column: column, Msg: "unexpected character " + strconv.QuoteRune(r)}
+}
+
+// number reads a decimal number with an optional unit suffix, e.g. 0.2, 1e3 or 30s
+func (l *lexer) number(column int) (token, error) {
+	start := l.pos
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+	if l.peek(0) == '.' {
+		l.pos++
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+	if c := l.peek(0); c == 'e' || c == 'E' {
+		// only an exponent if digits follow, otherwise a unit
+		if isDigit(l.peek(1)) {
+			l.pos += 1
+		} else if (l.peek(1) == '+' || l.peek(1) == '-') && isDigit(l.peek(2)) {
+			l.pos += 2
+		}
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+
+	numEnd := l.pos
+	value, err := strconv.ParseFloat(string(l.src[start:numEnd]), 64)
+	if err != nil {
+		return token{}, &ParseError{Column: column, Msg: "invalid number " + strconv.Quote(string(l.src[start:numEnd]))}
+	}
+
+	for l.pos < len(l.src) && (isIdentChar(l.src[l.pos]) || l.src[l.pos] == '%') {
+		l.pos++
+	}
+
+	return token{
+		kind:   tokNumber,
+		text:   string(l.src[start:l.pos]),
+		column: column,
+		value:  value,
+		unit:   string(l.src[numEnd:l.pos]),
+	}, nil
+}
+
+func (l *lexer) string(column int, quote rune) (token, error) {
+	l.pos++ // opening quote
+
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		l.pos++
+		switch c {
+		case quote:
+			return token{kind: tokString, text: sb.String(), column: column}, nil
+		case '\\':
+			if l.pos >= len(l.src) {
+				break
+			}
+			sb.WriteRune(l.src[l.pos])
+			l.pos++
+		default:
+			sb.WriteRune(c)
+		}
+	}
+
+	return token{}, &ParseError{Column: column, Msg: "unterminated string"}
+}
@@ -0,0 +1,81 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLookback(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr string
+		want time.Duration
+	}{
+		{"x", 0},
+		{"x | gt 0.2", 0},
+		{"x | avg 30s", 30 * time.Second},
+		{"x | gt 0.2 | avg 30s", 30 * time.Second},
+		{"x | avg 10s | avg 20s triangle", 30 * time.Second},
+		{"(x | avg 10s) - (y | avg 1m | gt 1)", time.Minute},
+		{"sum(x | avg 1m, y) | avg 10s", 70 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := p.ParseNode(tt.expr, time.Unix(1000, 0))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, Lookback(node))
+		})
+	}
+}
+
+// history loaded from start minus lookback must give the same values after
+// start as an operator that has been streaming all along
+func TestLookbackMatchesStreaming(t *testing.T) {
+	p := NewParser()
+
+	var input []schema.Value
+	for i := 0; i < 200; i++ {
+		input = append(input, schema.Value{
+			Timestamp: time.Unix(int64(i), 0),
+			Value:     float64(i % 7),
+		})
+	}
+
+	start := time.Unix(100, 0)
+
+	for _, expr := range []string{
+		"x | gt 3 | avg 30s",
+		"x | avg 10s | avg 20s triangle",
+		"x | avg 5s | gate 10s 2",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			streaming, err := p.ParseNode(expr, time.Time{})
+			require.NoError(t, err)
+
+			var want []schema.Value
+			for _, v := range streaming.Process("x", input) {
+				if !v.Timestamp.Before(start) {
+					want = append(want, v)
+				}
+			}
+
+			node, err := p.ParseNode(expr, start)
+			require.NoError(t, err)
+
+			from := start.Add(-Lookback(node))
+			var history []schema.Value
+			for _, v := range input {
+				if !v.Timestamp.Before(from) {
+					history = append(history, v)
+				}
+			}
+
+			got := node.Process("x", history)
+			require.Equal(t, want, got)
+		})
+	}
+}
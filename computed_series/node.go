@@ -0,0 +1,186 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"time"
+)
+
+// Node is a parsed series expression. New values of every input series are
+// passed to Process along with the name of the series they belong to.
+type Node interface {
+	// Inputs lists the distinct input series names in order of appearance
+	Inputs() []string
+	Process(seriesName string, values []schema.Value) []schema.Value
+}
+
+// Lookback returns how much history before the requested start a node needs
+// to produce correct values at the start
+func Lookback(n Node) time.Duration {
+	if wo, ok := n.(WindowedOperator); ok {
+		return wo.Lookback()
+	}
+	return 0
+}
+
+func opLookback(op Operator) time.Duration {
+	if wo, ok := op.(WindowedOperator); ok {
+		return wo.Lookback()
+	}
+	return 0
+}
+
+// unitOperator is an operator that changes the unit of its values
+type unitOperator interface {
+	OutputUnit() string
+}
+
+func opUnit(op Operator) (string, bool) {
+	switch op := op.(type) {
+	case unitOperator:
+		return op.OutputUnit(), true
+	case Chain:
+		for i := len(op.ops) - 1; i >= 0; i-- {
+			if u, ok := opUnit(op.ops[i]); ok {
+				return u, true
+			}
+		}
+	}
+	return "", false
+}
+
+// OutputUnit returns the unit a node converts its values to, if any
+func OutputUnit(n Node) (string, bool) {
+	switch n := n.(type) {
+	case startNode:
+		return OutputUnit(n.Node)
+	case PipeNode:
+		if u, ok := opUnit(n.Op); ok {
+			return u, true
+		}
+		return OutputUnit(n.Input)
+	}
+	return "", false
+}
+
+// IsInput reports whether n plots a single series unchanged
+func IsInput(n Node) bool {
+	switch n := n.(type) {
+	case startNode:
+		return IsInput(n.Node)
+	case InputNode:
+		return true
+	}
+	return false
+}
+
+// InputNode passes through the values of a single series
+type InputNode struct {
+	Name string
+}
+
+func (n InputNode) Inputs() []string {
+	return []string{n.Name}
+}
+
+func (n InputNode) Process(seriesName string, values []schema.Value) []schema.Value {
+	if seriesName != n.Name {
+		return nil
+	}
+	return values
+}
+
+// PipeNode applies an operator to the output of another node
+type PipeNode struct {
+	Input Node
+	Op    Operator
+}
+
+func (n PipeNode) Inputs() []string {
+	return n.Input.Inputs()
+}
+
+func (n PipeNode) Process(seriesName string, values []schema.Value) []schema.Value {
+	values = n.Input.Process(seriesName, values)
+	if len(values) == 0 {
+		return nil
+	}
+	return n.Op.ProcessNewValues(values)
+}
+
+func (n PipeNode) Lookback() time.Duration {
+	return opLookback(n.Op) + Lookback(n.Input)
+}
+
+// CombineNode aligns the outputs of several nodes by timestamp and combines
+// them into one value per timestamp
+type CombineNode struct {
+	children []Node
+	fcn      CombineFcn
+	align    *aligner
+}
+
+func NewCombineNode(children []Node, fcn CombineFcn, alignment Alignment) *CombineNode {
+	return &CombineNode{
+		children: children,
+		fcn:      fcn,
+		align:    newAligner(len(children), alignment),
+	}
+}
+
+func (n *CombineNode) Inputs() []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, child := range n.children {
+		for _, name := range child.Inputs() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func (n *CombineNode) Process(seriesName string, values []schema.Value) []schema.Value {
+	for idx, child := range n.children {
+		out := child.Process(seriesName, values)
+		n.align.add(idx, out)
+	}
+	return n.align.drain(n.fcn)
+}
+
+func (n *CombineNode) Lookback() time.Duration {
+	var result time.Duration
+	for _, child := range n.children {
+		result = max(result, Lookback(child))
+	}
+	return result
+}
+
+// startNode drops output before start. It only wraps the whole expression so
+// that windowed stages inside it still see the history before start.
+type startNode struct {
+	Node
+	start time.Time
+}
+
+func (n startNode) Process(seriesName string, values []schema.Value) []schema.Value {
+	values = n.Node.Process(seriesName, values)
+	if len(values) == 0 || !values[0].Timestamp.Before(n.start) {
+		return values
+	}
+
+	// values may be the caller's slice, don't filter in place
+	var result []schema.Value
+	for _, v := range values {
+		if !v.Timestamp.Before(n.start) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func (n startNode) Lookback() time.Duration {
+	return Lookback(n.Node)
+}
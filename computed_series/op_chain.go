@@ -2,6 +2,7 @@ package computed_series
 
 import (
 	"github.com/minor-industries/rtgraph/schema"
+	"time"
 )
 
 type Chain struct {
@@ -14,3 +15,13 @@ func (c Chain) ProcessNewValues(values []schema.Value) []schema.Value {
 	}
 	return values
 }
+
+// Lookback adds up the windows of every stage, each stage needs a full window
+// of output from the stage before it
+func (c Chain) Lookback() time.Duration {
+	var result time.Duration
+	for _, op := range c.ops {
+		result += opLookback(op)
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"math"
+	"time"
+)
+
+// emaLookbackHalfLives is how much history an EMA is warmed up with, after
+// ten half-lives the initial value weighs less than 0.1%
+const emaLookbackHalfLives = 10
+
+// OpEMA is an exponential moving average that decays with elapsed time, not
+// sample count, so irregularly spaced samples are weighted correctly
+type OpEMA struct {
+	halfLife time.Duration
+	last     schema.Value
+	started  bool
+}
+
+func NewOpEMA(halfLife time.Duration) *OpEMA {
+	return &OpEMA{halfLife: halfLife}
+}
+
+func (o *OpEMA) Lookback() time.Duration {
+	return emaLookbackHalfLives * o.halfLife
+}
+
+func (o *OpEMA) ProcessNewValues(values []schema.Value) []schema.Value {
+	result := make([]schema.Value, 0, len(values))
+
+	for _, v := range values {
+		if !o.started {
+			o.last = v
+			o.started = true
+			result = append(result, v)
+			continue
+		}
+
+		dt := v.Timestamp.Sub(o.last.Timestamp)
+		if dt < 0 {
+			continue // out of order
+		}
+
+		// weight of the previous average after dt
+		keep := math.Exp2(-float64(dt) / float64(o.halfLife))
+		o.last = schema.Value{
+			Timestamp: v.Timestamp,
+			Value:     keep*o.last.Value + (1-keep)*v.Value,
+		}
+		result = append(result, o.last)
+	}
+
+	return result
+}
@@ -0,0 +1,79 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"time"
+)
+
+// OpGate passes values through only while a gate is open. It opens once the
+// value has stayed above Open for OpenFor, and closes once it has stayed below
+// Close for CloseFor. A Close below Open gives hysteresis, so a value hovering
+// around one threshold doesn't flap. With State set it emits 1 while open and
+// 0 while closed for every value instead. A Close of -Inf never closes.
+type OpGate struct {
+	Open     float64
+	Close    float64
+	OpenFor  time.Duration
+	CloseFor time.Duration
+	State    bool
+
+	// history replayed to settle the state at the start of a range
+	Settle time.Duration
+
+	open  bool
+	since time.Time // when the condition for switching began to hold
+	armed bool      // since is set
+}
+
+func (o *OpGate) Lookback() time.Duration {
+	return o.Settle
+}
+
+// update moves the state machine to v and reports whether the gate is open
+func (o *OpGate) update(v schema.Value) bool {
+	var switching bool
+	var holdFor time.Duration
+	if o.open {
+		switching, holdFor = v.Value < o.Close, o.CloseFor
+	} else {
+		switching, holdFor = v.Value > o.Open, o.OpenFor
+	}
+
+	if !switching {
+		o.armed = false
+		return o.open
+	}
+
+	if !o.armed {
+		o.since = v.Timestamp
+		o.armed = true
+	}
+
+	if v.Timestamp.Sub(o.since) >= holdFor {
+		o.open = !o.open
+		o.armed = false
+	}
+
+	return o.open
+}
+
+func (o *OpGate) ProcessNewValues(values []schema.Value) []schema.Value {
+	result := make([]schema.Value, 0, len(values))
+
+	for _, v := range values {
+		open := o.update(v)
+
+		switch {
+		case o.State:
+			state := 0.0
+			if open {
+				state = 1
+			}
+			result = append(result, schema.Value{Timestamp: v.Timestamp, Value: state})
+		case open:
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
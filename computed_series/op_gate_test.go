@@ -0,0 +1,74 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGate(t *testing.T) {
+	p := NewParser()
+
+	// heart rate that climbs, hovers around 100 and drops
+	input := values(
+		0, 80,
+		1, 105,
+		2, 99,
+		3, 102,
+		4, 110,
+		5, 95,
+		6, 85,
+		7, 84,
+		8, 83,
+		9, 120,
+	)
+
+	tests := []struct {
+		expr string
+		want []schema.Value
+	}{
+		{
+			// stays open once opened
+			expr: "hr | gate 1m 100",
+			want: values(1, 105, 2, 99, 3, 102, 4, 110, 5, 95, 6, 85, 7, 84, 8, 83, 9, 120),
+		},
+		{
+			// no hysteresis: follows every crossing
+			expr: "hr | gate 1m 100 close=100",
+			want: values(1, 105, 3, 102, 4, 110, 9, 120),
+		},
+		{
+			expr: "hr | gate 1m 100 close=90",
+			want: values(1, 105, 2, 99, 3, 102, 4, 110, 5, 95, 9, 120),
+		},
+		{
+			// must stay above 100 for 1s before opening
+			expr: "hr | gate 1m 100 close=90 openFor=1s",
+			want: values(4, 110, 5, 95),
+		},
+		{
+			// must stay below 90 for 1s before closing
+			expr: "hr | gate 1m 100 close=90 closeFor=1s",
+			want: values(1, 105, 2, 99, 3, 102, 4, 110, 5, 95, 6, 85, 9, 120),
+		},
+		{
+			expr: "hr | gate 1m 100 close=90 mode=state",
+			want: values(0, 0, 1, 1, 2, 1, 3, 1, 4, 1, 5, 1, 6, 0, 7, 0, 8, 0, 9, 1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := p.ParseNode(tt.expr, time.Time{})
+			require.NoError(t, err)
+			require.Equal(t, time.Minute, Lookback(node))
+			require.Equal(t, tt.want, node.Process("hr", input))
+		})
+	}
+
+	_, err := p.ParseNode("hr | gate 1m 100 close=110", time.Time{})
+	require.Error(t, err)
+	_, err = p.ParseNode("hr | gate 1m 100 closeFor=1s", time.Time{})
+	require.Error(t, err)
+}
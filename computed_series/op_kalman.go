@@ -0,0 +1,70 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"math"
+	"time"
+)
+
+// OpKalman is a 1D Kalman filter for a value that drifts as a random walk.
+// processNoise is the variance the true value gains per second, measurementNoise
+// the variance of each sample. Their ratio sets how quickly it follows changes.
+type OpKalman struct {
+	processNoise     float64
+	measurementNoise float64
+
+	estimate float64
+	variance float64
+	lastTime time.Time
+	started  bool
+}
+
+func NewOpKalman(processNoise, measurementNoise float64) *OpKalman {
+	return &OpKalman{
+		processNoise:     processNoise,
+		measurementNoise: measurementNoise,
+	}
+}
+
+// Lookback covers ten time constants of the steady state filter, sqrt(r/q) seconds
+func (o *OpKalman) Lookback() time.Duration {
+	if o.processNoise <= 0 {
+		return 0
+	}
+	tau := math.Sqrt(o.measurementNoise / o.processNoise)
+	return time.Duration(10 * tau * float64(time.Second))
+}
+
+func (o *OpKalman) ProcessNewValues(values []schema.Value) []schema.Value {
+	result := make([]schema.Value, 0, len(values))
+
+	for _, v := range values {
+		if !o.started {
+			o.estimate = v.Value
+			o.variance = o.measurementNoise
+			o.lastTime = v.Timestamp
+			o.started = true
+			result = append(result, v)
+			continue
+		}
+
+		dt := v.Timestamp.Sub(o.lastTime).Seconds()
+		if dt < 0 {
+			continue // out of order
+		}
+		o.lastTime = v.Timestamp
+
+		// predict, then update with the measurement
+		o.variance += o.processNoise * dt
+		gain := o.variance / (o.variance + o.measurementNoise)
+		o.estimate += gain * (v.Value - o.estimate)
+		o.variance *= 1 - gain
+
+		result = append(result, schema.Value{
+			Timestamp: v.Timestamp,
+			Value:     o.estimate,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,149 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"math"
+	"time"
+)
+
+// maxFillBuckets is the longest gap, in buckets, that is filled. Longer gaps
+// are left empty, as with fill=none.
+const maxFillBuckets = 10000
+
+var resampleAggregations = []string{"mean", "last", "first", "min", "max", "sum", "count"}
+var resampleFills = []string{"none", "previous", "linear", "zero"}
+
+// OpResample emits one value per interval, aligned to the Unix epoch and
+// stamped with the start of the bucket. A bucket is only emitted once a value
+// arrives in a later bucket, so results never change after they are sent;
+// operators see no clock, so the newest bucket waits for the next value
+// however long that takes. Empty buckets between two closed ones are left
+// out, or filled with the previous value, zero, or by interpolating between
+// their neighbours, up to maxFillBuckets of them.
+type OpResample struct {
+	interval time.Duration
+	agg      string
+	fill     string
+
+	current    time.Time // start of the bucket being collected
+	hasCurrent bool
+	count      int
+	sum        float64
+	min, max   float64
+	first      float64
+	last       float64
+
+	lastEmitted schema.Value
+	hasEmitted  bool
+}
+
+func NewOpResample(interval time.Duration, agg, fill string) *OpResample {
+	return &OpResample{interval: interval, agg: agg, fill: fill}
+}
+
+// Lookback covers the bucket before start so fills have a previous value
+func (o *OpResample) Lookback() time.Duration {
+	return o.interval
+}
+
+func (o *OpResample) bucket(ts time.Time) time.Time {
+	ns := ts.UnixNano()
+	d := int64(o.interval)
+	offset := ns % d
+	if offset < 0 {
+		offset += d
+	}
+	return time.Unix(0, ns-offset)
+}
+
+func (o *OpResample) add(v float64) {
+	if o.count == 0 {
+		o.sum, o.min, o.max, o.first = 0, v, v, v
+	}
+	o.count++
+	o.sum += v
+	o.min = math.Min(o.min, v)
+	o.max = math.Max(o.max, v)
+	o.last = v
+}
+
+func (o *OpResample) value() float64 {
+	switch o.agg {
+	case "last":
+		return o.last
+	case "first":
+		return o.first
+	case "min":
+		return o.min
+	case "max":
+		return o.max
+	case "sum":
+		return o.sum
+	case "count":
+		return float64(o.count)
+	}
+	return o.sum / float64(o.count)
+}
+
+// fillGap emits the empty buckets strictly between from and to. next is the
+// value of the bucket at to, which linear fill interpolates towards.
+func (o *OpResample) fillGap(result []schema.Value, from schema.Value, to time.Time, next float64) []schema.Value {
+	if to.Sub(from.Timestamp)/o.interval-1 > maxFillBuckets {
+		return result
+	}
+	span := float64(to.Sub(from.Timestamp))
+	for t := from.Timestamp.Add(o.interval); t.Before(to); t = t.Add(o.interval) {
+		v := from.Value
+		switch o.fill {
+		case "zero":
+			v = 0
+		case "linear":
+			v += (next - from.Value) * float64(t.Sub(from.Timestamp)) / span
+		}
+		result = append(result, schema.Value{Timestamp: t, Value: v})
+	}
+	return result
+}
+
+// close emits the current bucket, and for previous and zero fill the empty
+// buckets up to next, which are known to be closed too
+func (o *OpResample) close(result []schema.Value, next time.Time) []schema.Value {
+	v := schema.Value{Timestamp: o.current, Value: o.value()}
+
+	if o.fill == "linear" && o.hasEmitted {
+		result = o.fillGap(result, o.lastEmitted, v.Timestamp, v.Value)
+	}
+	result = append(result, v)
+	o.lastEmitted = v
+	o.hasEmitted = true
+
+	if o.fill == "previous" || o.fill == "zero" {
+		result = o.fillGap(result, v, next, 0)
+	}
+
+	return result
+}
+
+func (o *OpResample) ProcessNewValues(values []schema.Value) []schema.Value {
+	var result []schema.Value
+
+	for _, v := range values {
+		b := o.bucket(v.Timestamp)
+
+		switch {
+		case !o.hasCurrent:
+			o.current = b
+			o.hasCurrent = true
+		case b.Before(o.current):
+			continue // belongs to a bucket that was already emitted
+		case b.After(o.current):
+			result = o.close(result, b)
+			o.current = b
+			o.count = 0
+		}
+
+		o.add(v.Value)
+	}
+
+	return result
+}
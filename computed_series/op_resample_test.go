@@ -0,0 +1,105 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestResample(t *testing.T) {
+	p := NewParser()
+
+	// buckets [0,10) and [10,20) have values, [20,40) is empty, [40,50) is
+	// open and must not be emitted
+	input := values(
+		1, 1,
+		4, 3,
+		9, 2,
+		12, 10,
+		45, 20,
+	)
+
+	tests := []struct {
+		expr string
+		want []schema.Value
+	}{
+		{"x | resample 10s", values(0, 2, 10, 10)},
+		{"x | resample 10s last", values(0, 2, 10, 10)},
+		{"x | resample 10s first", values(0, 1, 10, 10)},
+		{"x | resample 10s min", values(0, 1, 10, 10)},
+		{"x | resample 10s max", values(0, 3, 10, 10)},
+		{"x | resample 10s sum", values(0, 6, 10, 10)},
+		{"x | resample 10s count", values(0, 3, 10, 1)},
+		{"x | resample 10s fill=previous", values(0, 2, 10, 10, 20, 10, 30, 10)},
+		{"x | resample 10s fill=zero", values(0, 2, 10, 10, 20, 0, 30, 0)},
+		// linear fill needs the next bucket to close first
+		{"x | resample 10s fill=linear", values(0, 2, 10, 10)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := p.ParseNode(tt.expr, time.Time{})
+			require.NoError(t, err)
+			require.Equal(t, 10*time.Second, Lookback(node))
+
+			// all at once, as history is loaded
+			require.Equal(t, tt.want, node.Process("x", input))
+
+			// one value at a time, as when streaming
+			node, err = p.ParseNode(tt.expr, time.Time{})
+			require.NoError(t, err)
+
+			var got []schema.Value
+			for i := range input {
+				got = append(got, node.Process("x", input[i:i+1])...)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResampleLinearFill(t *testing.T) {
+	p := NewParser()
+
+	node, err := p.ParseNode("x | resample 10s fill=linear", time.Time{})
+	require.NoError(t, err)
+
+	got := node.Process("x", values(5, 0, 45, 40, 55, 0))
+	require.Equal(t, values(0, 0, 10, 10, 20, 20, 30, 30, 40, 40), got)
+
+	// values for buckets already emitted are dropped
+	require.Empty(t, node.Process("x", values(44, 100)))
+}
+
+func TestResampleOpenBucket(t *testing.T) {
+	p := NewParser()
+
+	node, err := p.ParseNode("x | resample 10s", time.Time{})
+	require.NoError(t, err)
+
+	// the newest bucket is held however much later it gets, until a value
+	// arrives in a later bucket
+	require.Empty(t, node.Process("x", values(1, 1)))
+	require.Empty(t, node.Process("x", values(9, 3)))
+	require.Equal(t, values(0, 2), node.Process("x", values(3600, 5)))
+}
+
+func TestResampleLongGap(t *testing.T) {
+	p := NewParser()
+
+	for _, fill := range []string{"previous", "zero", "linear"} {
+		t.Run(fill, func(t *testing.T) {
+			node, err := p.ParseNode("x | resample 1s fill="+fill, time.Time{})
+			require.NoError(t, err)
+
+			// a gap of exactly maxFillBuckets is filled
+			got := node.Process("x", values(0, 1, maxFillBuckets+1, 1, maxFillBuckets+2, 1))
+			require.Len(t, got, maxFillBuckets+2)
+
+			// a longer one is left empty rather than partly filled
+			got = node.Process("x", values(2*maxFillBuckets+4, 1, 2*maxFillBuckets+5, 1))
+			require.Equal(t, values(maxFillBuckets+2, 1, 2*maxFillBuckets+4, 1), got)
+		})
+	}
+}
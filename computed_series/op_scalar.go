@@ -0,0 +1,29 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+)
+
+// OpScalar applies a binary operator between each value and a constant.
+// Left puts the constant on the left hand side, e.g. 1 / x.
+type OpScalar struct {
+	Op   string
+	X    float64
+	Left bool
+}
+
+func (o OpScalar) ProcessNewValues(values []schema.Value) []schema.Value {
+	fcn := binaryOperators[o.Op]
+	result := make([]schema.Value, len(values))
+	for idx, value := range values {
+		args := [2]float64{value.Value, o.X}
+		if o.Left {
+			args = [2]float64{o.X, value.Value}
+		}
+		result[idx] = schema.Value{
+			Timestamp: value.Timestamp,
+			Value:     fcn(args[:]),
+		}
+	}
+	return result
+}
@@ -1,159 +1,550 @@
 package computed_series
 
 import (
+	"fmt"
+	"github.com/minor-industries/rtgraph/schema"
 	"github.com/pkg/errors"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Parser struct {
-	functions map[string]FunctionParser
+	functions map[string]Function
+	unitOf    func(seriesName string) (string, error)
+	isSeries  func(seriesName string) bool
 }
 
-var builtInParsers = map[string]FunctionParser{
-	"avg": func(start time.Time, args []string) (Operator, error) {
-		duration, err := time.ParseDuration(args[0])
-		if err != nil {
-			return nil, errors.Wrap(err, "parse duration")
-		}
-		switch len(args) {
-		case 1:
-			return NewComputedSeries(&FcnAvg{}, duration, start), nil
-		case 2:
-			switch args[1] {
-			case "triangle":
+var builtInFunctions = []Function{
+	{
+		Name:        "avg",
+		Description: "moving average over a trailing window",
+		Args: []ArgSpec{
+			{Name: "duration", Type: ArgDuration},
+			{Name: "window", Type: ArgEnum, Values: []string{"flat", "triangle"}, Default: "flat",
+				Description: "triangle weights recent values more"},
+		},
+		New: func(start time.Time, args Args) (Operator, error) {
+			duration := args.Duration("duration")
+			if args.String("window") == "triangle" {
 				return NewComputedSeries(&FcnAvgWindow{
 					duration: duration,
 					scale:    1.0 / float64(duration),
-				}, duration, start), nil
+				}, duration, time.Time{}), nil
 			}
-			return nil, errors.New("unknown window")
-		default:
-			return nil, errors.New("avg: invalid number of function parameters")
-		}
+			return NewComputedSeries(&FcnAvg{}, duration, time.Time{}), nil
+		},
 	},
-
-	"gt": func(start time.Time, args []string) (Operator, error) {
-		x, err := strconv.ParseFloat(args[0], 64)
-		if err != nil {
-			return nil, errors.Wrap(err, "invalid float")
-		}
-		return OpGt{X: x}, nil
+	{
+		Name:        "gt",
+		Description: "1 when the value is greater than x, otherwise 0",
+		Args:        []ArgSpec{{Name: "x", Type: ArgFloat}},
+		New: func(start time.Time, args Args) (Operator, error) {
+			return OpGt{X: args.Float("x")}, nil
+		},
 	},
-
-	"add": func(start time.Time, args []string) (Operator, error) {
-		x, err := strconv.ParseFloat(args[0], 64)
-		if err != nil {
-			return nil, errors.Wrap(err, "invalid float")
-		}
-		return OpAdd{X: x}, nil
+	{
+		Name:        "add",
+		Description: "adds x to every value",
+		Args:        []ArgSpec{{Name: "x", Type: ArgFloat}},
+		New: func(start time.Time, args Args) (Operator, error) {
+			return OpAdd{X: args.Float("x")}, nil
+		},
 	},
-
-	"CtoF": func(start time.Time, args []string) (Operator, error) {
-		return OpCtoF{}, nil
+	{
+		Name:        "CtoF",
+		Description: "converts Celsius to Fahrenheit",
+		New: func(start time.Time, args Args) (Operator, error) {
+			return OpCtoF{}, nil
+		},
 	},
+	{
+		Name:        "gate",
+		Description: "passes values through once the value goes above open, optionally closing again",
+		Args: []ArgSpec{
+			{Name: "duration", Type: ArgDuration, Description: "history used to settle the state at the start"},
+			{Name: "open", Type: ArgFloat, Description: "opens when the value is above this"},
+			{Name: "close", Type: ArgFloat, Optional: true, Description: "closes when the value is below this, without it the gate stays open"},
+			{Name: "openFor", Type: ArgDuration, Optional: true, Description: "how long the value must stay above open"},
+			{Name: "closeFor", Type: ArgDuration, Optional: true, Description: "how long the value must stay below close"},
+			{Name: "mode", Type: ArgEnum, Values: []string{"values", "state"}, Default: "values",
+				Description: "state emits 1 while open and 0 while closed"},
+		},
+		New: func(start time.Time, args Args) (Operator, error) {
+			op := &OpGate{
+				Open:     args.Float("open"),
+				Close:    math.Inf(-1),
+				OpenFor:  args.Duration("openFor"),
+				CloseFor: args.Duration("closeFor"),
+				State:    args.String("mode") == "state",
+				Settle:   args.Duration("duration"),
+			}
+			if args.Has("close") {
+				op.Close = args.Float("close")
+			} else if args.Has("closeFor") {
+				return nil, errors.New("closeFor needs close")
+			}
+			if op.Close > op.Open {
+				return nil, errors.New("close must not be above open")
+			}
+			return op, nil
+		},
+	},
+	windowFunction("min", "rolling minimum", func() Fcn { return NewFcnMin() }),
+	windowFunction("max", "rolling maximum", func() Fcn { return NewFcnMax() }),
+	windowFunction("median", "rolling median", func() Fcn { return NewFcnQuantile(0.5) }),
+	windowFunction("stddev", "rolling population standard deviation", func() Fcn { return &FcnVariance{stddev: true} }),
+	windowFunction("variance", "rolling population variance", func() Fcn { return &FcnVariance{} }),
+	windowFunction("count", "number of values in the window", func() Fcn { return &FcnCount{} }),
+	windowFunction("sum", "rolling sum", func() Fcn { return &FcnSum{} }),
+	windowFunction("increase", "counter increase over the window, allowing for resets", func() Fcn { return NewFcnIncrease() }),
+	windowFunction("rate", "per-second counter increase over the window, allowing for resets", func() Fcn { return NewFcnRate() }),
+	windowFunction("delta", "last minus first value in the window", func() Fcn { return &FcnDelta{} }),
+	windowFunction("deriv", "per-second slope of a least squares fit over the window", func() Fcn { return &FcnDeriv{} }),
+	{
+		Name:        "integral",
+		Description: "trapezoidal integral over the window",
+		Args: []ArgSpec{
+			{Name: "duration", Type: ArgDuration},
+			{Name: "unit", Type: ArgDuration, Default: "1s",
+				Description: "time unit of the result, e.g. 1h turns W into Wh"},
+		},
+		New: func(start time.Time, args Args) (Operator, error) {
+			return NewComputedSeries(NewFcnIntegral(args.Duration("unit")), args.Duration("duration"), time.Time{}), nil
+		},
+	},
+	{
+		Name:        "ema",
+		Description: "exponential moving average that decays with time",
+		Args:        []ArgSpec{{Name: "halfLife", Type: ArgDuration}},
+		New: func(start time.Time, args Args) (Operator, error) {
+			return NewOpEMA(args.Duration("halfLife")), nil
+		},
+	},
+	{
+		Name:        "savgol",
+		Description: "Savitzky-Golay smoothing, a polynomial fit over the trailing window",
+		Args: []ArgSpec{
+			{Name: "duration", Type: ArgDuration},
+			{Name: "order", Type: ArgInt, Default: "2", Description: "polynomial order, 0 to 5"},
+		},
+		New: func(start time.Time, args Args) (Operator, error) {
+			order := args.Int("order")
+			if order < 0 || order > 5 {
+				return nil, errors.Errorf("order must be between 0 and 5, got %d", order)
+			}
+			duration := args.Duration("duration")
+			return NewComputedSeries(&FcnSavGol{duration: duration, order: order}, duration, time.Time{}), nil
+		},
+	},
+	{
+		Name:        "kalman",
+		Description: "1D Kalman filter for a randomly drifting value",
+		Args: []ArgSpec{
+			{Name: "q", Type: ArgFloat, Description: "process variance per second"},
+			{Name: "r", Type: ArgFloat, Description: "measurement variance"},
+		},
+		New: func(start time.Time, args Args) (Operator, error) {
+			q, r := args.Float("q"), args.Float("r")
+			if q <= 0 || r <= 0 {
+				return nil, errors.New("q and r must be positive")
+			}
+			return NewOpKalman(q, r), nil
+		},
+	},
+	{
+		Name:        "resample",
+		Description: "one value per aligned interval, emitted when a value arrives in a later interval",
+		Args: []ArgSpec{
+			{Name: "interval", Type: ArgDuration},
+			{Name: "agg", Type: ArgEnum, Values: resampleAggregations, Default: "mean"},
+			{Name: "fill", Type: ArgEnum, Values: resampleFills, Default: "none",
+				Description: "how empty intervals are filled, gaps over 10000 intervals stay empty"},
+		},
+		New: func(start time.Time, args Args) (Operator, error) {
+			return NewOpResample(args.Duration("interval"), args.String("agg"), args.String("fill")), nil
+		},
+	},
+	{
+		Name:        "convert",
+		Description: "converts between units, from defaults to the stored unit of the series",
+		Args: []ArgSpec{
+			{Name: "from", Type: ArgString, Description: `units such as "km/h" or "°C" must be quoted`},
+			{Name: "to", Type: ArgString, Optional: true},
+		},
+		New: func(start time.Time, args Args) (Operator, error) {
+			if args.Has("to") {
+				return NewOpConvert(args.String("from"), args.String("to"))
+			}
 
-	"gate": func(start time.Time, args []string) (Operator, error) {
-		if len(args) != 2 {
-			return nil, errors.New("gate: invalid number of function parameters")
-		}
-		duration, err := time.ParseDuration(args[0])
-		if err != nil {
-			return nil, errors.Wrap(err, "parse duration")
-		}
-		target, err := strconv.ParseFloat(args[1], 64)
-		if err != nil {
-			return nil, errors.Wrap(err, "invalid float")
-		}
-		return NewComputedSeries(&FcnGate{
-			target: target,
-		}, duration, start), nil
+			// a single argument is the unit to convert to
+			from, err := args.InputUnit()
+			if err != nil {
+				return nil, err
+			}
+			return NewOpConvert(from, args.String("from"))
+		},
+	},
+	{
+		Name:        "percentile",
+		Description: "rolling percentile, also available as pN, e.g. p95 1m",
+		Args: []ArgSpec{
+			{Name: "duration", Type: ArgDuration},
+			{Name: "p", Type: ArgFloat, Description: "0 to 100"},
+		},
+		New: func(start time.Time, args Args) (Operator, error) {
+			return newPercentile(args.Duration("duration"), args.Float("p"))
+		},
 	},
 }
 
+// windowFunction declares a Fcn computed over a trailing window
+func windowFunction(name, description string, newFcn func() Fcn) Function {
+	return Function{
+		Name:        name,
+		Description: description,
+		Args:        []ArgSpec{{Name: "duration", Type: ArgDuration}},
+		New: func(start time.Time, args Args) (Operator, error) {
+			return NewComputedSeries(newFcn(), args.Duration("duration"), time.Time{}), nil
+		},
+	}
+}
+
+func newPercentile(duration time.Duration, p float64) (Operator, error) {
+	if p < 0 || p > 100 {
+		return nil, errors.Errorf("percentile must be between 0 and 100, got %v", p)
+	}
+	return NewComputedSeries(NewFcnQuantile(p/100), duration, time.Time{}), nil
+}
+
+var percentileName = regexp.MustCompile(`^p(\d+(\.\d+)?)$`)
+
+// lookup finds a registered function, or a pN percentile such as p95 or p99.9
+func (p *Parser) lookup(name string) (Function, bool) {
+	if fn, ok := p.functions[name]; ok {
+		return fn, true
+	}
+
+	m := percentileName.FindStringSubmatch(name)
+	if m == nil {
+		return Function{}, false
+	}
+	pct, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || pct > 100 {
+		return Function{}, false
+	}
+
+	return Function{
+		Name: name,
+		Args: []ArgSpec{{Name: "duration", Type: ArgDuration}},
+		New: func(start time.Time, args Args) (Operator, error) {
+			return newPercentile(args.Duration("duration"), pct)
+		},
+	}, true
+}
+
 func NewParser() *Parser {
-	return &Parser{
-		functions: builtInParsers,
+	p := &Parser{
+		functions: map[string]Function{},
 	}
+	for _, fn := range builtInFunctions {
+		if err := p.AddFunction(fn); err != nil {
+			panic(err)
+		}
+	}
+	return p
 }
 
-func (p *Parser) AddFunction(name string, parser FunctionParser) {
-	p.functions[name] = parser
+// SetUnitLookup lets functions such as convert default to the stored unit of their input series
+func (p *Parser) SetUnitLookup(unitOf func(seriesName string) (string, error)) {
+	p.unitOf = unitOf
 }
 
-type FunctionParser func(start time.Time, args []string) (Operator, error)
+// SetSeriesLookup lets Parse read a leading bare name that names a known
+// series literally, see Parse
+func (p *Parser) SetSeriesLookup(isSeries func(seriesName string) bool) {
+	p.isSeries = isSeries
+}
 
-func trimSpace(parts []string) []string {
-	for i, part := range parts {
-		parts[i] = strings.TrimSpace(part)
+// AddFunction registers a pipeline function, replacing any function of the same name
+func (p *Parser) AddFunction(fn Function) error {
+	if err := fn.validate(); err != nil {
+		return err
 	}
-	return parts
+	p.functions[fn.Name] = fn
+	return nil
 }
 
+// Parse compiles a pipeline over a single series, returning the name of the
+// series and an operator for its values. Use ParseNode for expressions that
+// combine several series.
 func (p *Parser) Parse(
 	s string,
-	start time.Time, // TODO: it's weird that we have to pass start in here
+	start time.Time, // output before start is dropped, zero keeps everything
 ) (string, Operator, error) {
-	if len(s) == 0 {
-		return "", nil, errors.New("empty series")
+	node, err := p.ParseNode(s, start)
+	if err != nil {
+		return "", nil, err
+	}
+
+	inputs := node.Inputs()
+	if len(inputs) != 1 {
+		return "", nil, errors.New("expression combines several series, use ParseNode")
 	}
+	return inputs[0], nodeOperator{node: node, input: inputs[0]}, nil
+}
 
-	mainParts := trimSpace(strings.Split(s, "|"))
+// nodeOperator feeds the values of a node's only input
+type nodeOperator struct {
+	node  Node
+	input string
+}
 
-	var series string
-	{
-		seriesParts := trimSpace(strings.Fields(mainParts[0]))
-		if len(seriesParts) > 1 {
-			return "", nil, errors.New("invalid series name")
+func (o nodeOperator) ProcessNewValues(values []schema.Value) []schema.Value {
+	return o.node.Process(o.input, values)
+}
+
+func (o nodeOperator) Lookback() time.Duration {
+	return Lookback(o.node)
+}
+
+// ParseNode compiles an expression such as
+//
+//	sample1 | gt 0.2 | avg 30s triangle
+//	interp(voltage * current) | avg 1m
+//	("outdoor temp" - indoor) * 1.8
+//
+// Series names other than letters, digits, _ . and : must be quoted, as in
+// "node_cpu{mode=\"idle\"}". For names written before the expression grammar
+// existed, a first stage without spaces that names a known series (see
+// SetSeriesLookup) is read as that series, so foo/bar stays a name when it is
+// stored as one; write foo / bar to divide.
+func (p *Parser) ParseNode(
+	s string,
+	start time.Time, // output before start is dropped, zero keeps everything
+) (Node, error) {
+	s, legacy := p.legacyName(s)
+	expr, err := ParseExpr(s)
+	if err != nil {
+		if perr, ok := err.(*ParseError); ok && !legacy {
+			if head, end := bareHead(s); head != "" && !isBareName(head) && perr.Column <= end {
+				perr.Msg += "; quote series names containing other characters"
+			}
 		}
-		series = seriesParts[0]
+		return nil, err
+	}
+
+	c, err := p.compile(expr, start, AlignHold)
+	if err != nil {
+		return nil, err
+	}
+	if c.node == nil {
+		return nil, &ParseError{Column: expr.Pos(), Msg: "expression must reference a series"}
 	}
 
-	switch len(mainParts) {
-	case 1:
-		return series, Identity{}, nil
-	case 2:
-		op, err := p.parseFunction(start, mainParts[1])
-		return series, op, err
-	default:
-		op, err := p.parseChain(start, mainParts[1:])
-		return series, op, err
+	if start.IsZero() {
+		return c.node, nil
 	}
+	return startNode{Node: c.node, start: start}, nil
 }
 
-func (p *Parser) parseFunction(
-	start time.Time,
-	def string,
-) (Operator, error) {
-	fields := trimSpace(strings.Fields(def))
+// bareHead returns the first pipeline stage when it is a single word, and
+// the column of its last character
+func bareHead(s string) (string, int) {
+	head, _, _ := strings.Cut(s, "|")
+	trimmed := strings.TrimSpace(head)
+	if trimmed == "" || strings.IndexFunc(trimmed, unicode.IsSpace) >= 0 {
+		return "", 0
+	}
+	end := utf8.RuneCountInString(strings.TrimRightFunc(head, unicode.IsSpace))
+	return trimmed, end
+}
 
-	if len(fields) == 0 {
-		return nil, errors.New("invalid number of function parameters")
+// legacyName quotes a leading bare name that the grammar would read
+// differently, such as foo/bar, when it names a known series
+func (p *Parser) legacyName(s string) (string, bool) {
+	name, _ := bareHead(s)
+	if name == "" || p.isSeries == nil || isBareName(name) || !p.isSeries(name) {
+		return s, false
+	}
+	_, rest, piped := strings.Cut(s, "|")
+	if !piped {
+		return quoteName(name), true
+	}
+	return quoteName(name) + " |" + rest, true
+}
+
+// compiled is either a node or a constant folded from number literals
+type compiled struct {
+	node     Node
+	constant float64
+}
+
+func (p *Parser) compile(expr Expr, start time.Time, alignment Alignment) (compiled, error) {
+	switch e := expr.(type) {
+	case *SeriesRef:
+		return compiled{node: InputNode{Name: e.Name}}, nil
+
+	case *NumberLit:
+		if e.Unit != "" {
+			return compiled{}, &ParseError{Column: e.Column, Msg: fmt.Sprintf("unexpected unit %q in arithmetic", e.Unit)}
+		}
+		return compiled{constant: e.Value}, nil
+
+	case *UnaryExpr:
+		x, err := p.compile(e.X, start, alignment)
+		if err != nil {
+			return compiled{}, err
+		}
+		if x.node == nil {
+			return compiled{constant: -x.constant}, nil
+		}
+		return compiled{node: PipeNode{Input: x.node, Op: OpScalar{Op: "*", X: -1}}}, nil
+
+	case *BinaryExpr:
+		x, err := p.compile(e.X, start, alignment)
+		if err != nil {
+			return compiled{}, err
+		}
+		y, err := p.compile(e.Y, start, alignment)
+		if err != nil {
+			return compiled{}, err
+		}
+
+		fcn := binaryOperators[e.Op]
+		switch {
+		case x.node == nil && y.node == nil:
+			return compiled{constant: fcn([]float64{x.constant, y.constant})}, nil
+		case y.node == nil:
+			return compiled{node: PipeNode{Input: x.node, Op: OpScalar{Op: e.Op, X: y.constant}}}, nil
+		case x.node == nil:
+			return compiled{node: PipeNode{Input: y.node, Op: OpScalar{Op: e.Op, X: x.constant, Left: true}}}, nil
+		}
+		return compiled{node: NewCombineNode([]Node{x.node, y.node}, fcn, alignment)}, nil
+
+	case *CallExpr:
+		return p.compileCall(e, start, alignment)
+
+	case *PipeExpr:
+		return p.compilePipe(e, start, alignment)
+	}
+
+	return compiled{}, &ParseError{Column: expr.Pos(), Msg: fmt.Sprintf("unsupported expression %s", expr)}
+}
+
+func (p *Parser) compileCall(e *CallExpr, start time.Time, alignment Alignment) (compiled, error) {
+	if a, ok := alignments[e.Func]; ok {
+		if len(e.Args) != 1 {
+			return compiled{}, &ParseError{Column: e.Column, Msg: fmt.Sprintf("%s takes exactly one argument", e.Func)}
+		}
+		return p.compile(e.Args[0], start, a)
 	}
 
-	functionName := fields[0]
-	parser, ok := p.functions[functionName]
+	fcn, ok := combineFunctions[e.Func]
 	if !ok {
-		return nil, errors.New("unknown function name")
+		return compiled{}, &ParseError{Column: e.Column, Msg: fmt.Sprintf("unknown combining function %q", e.Func)}
 	}
 
-	return parser(start, fields[1:])
+	if len(e.Args) == 0 {
+		return compiled{}, &ParseError{Column: e.Column, Msg: fmt.Sprintf("%s needs at least one argument", e.Func)}
+	}
+
+	children := make([]Node, len(e.Args))
+	for i, arg := range e.Args {
+		c, err := p.compile(arg, start, alignment)
+		if err != nil {
+			return compiled{}, err
+		}
+		if c.node == nil {
+			return compiled{}, &ParseError{Column: arg.Pos(), Msg: fmt.Sprintf("%s: argument must reference a series", e.Func)}
+		}
+		children[i] = c.node
+	}
+
+	return compiled{node: NewCombineNode(children, fcn, alignment)}, nil
+}
+
+// compilePipe turns a run of pipeline stages into one PipeNode over their input
+func (p *Parser) compilePipe(e *PipeExpr, start time.Time, alignment Alignment) (compiled, error) {
+	var stages []*PipeExpr
+	var input Expr = e
+	for {
+		pipe, ok := input.(*PipeExpr)
+		if !ok {
+			break
+		}
+		stages = append([]*PipeExpr{pipe}, stages...)
+		input = pipe.X
+	}
+
+	source, err := p.compile(input, start, alignment)
+	if err != nil {
+		return compiled{}, err
+	}
+	if source.node == nil {
+		return compiled{}, &ParseError{Column: input.Pos(), Msg: "pipeline input must reference a series"}
+	}
+
+	unit := p.inputUnit(source.node)
+	ops := make([]Operator, len(stages))
+	for i, stage := range stages {
+		ops[i], err = p.compileStage(stage, start, unit)
+		if err != nil {
+			return compiled{}, err
+		}
+		if u, ok := opUnit(ops[i]); ok {
+			unit = func() (string, error) { return u, nil }
+		}
+	}
+
+	if len(ops) == 1 {
+		return compiled{node: PipeNode{Input: source.node, Op: ops[0]}}, nil
+	}
+	return compiled{node: PipeNode{Input: source.node, Op: Chain{ops: ops}}}, nil
 }
 
-func (p *Parser) parseChain(
-	start time.Time,
-	defs []string,
-) (Operator, error) {
-	var ops []Operator
+// inputUnit finds the unit of a node's output, if it's converted or has a single stored input series
+func (p *Parser) inputUnit(node Node) func() (string, error) {
+	return func() (string, error) {
+		if u, ok := OutputUnit(node); ok {
+			return u, nil
+		}
+
+		inputs := node.Inputs()
+		if len(inputs) != 1 || p.unitOf == nil {
+			return "", errors.New("the unit of the input is not known")
+		}
 
-	for _, def := range defs {
-		op, err := p.parseFunction(start, def)
+		u, err := p.unitOf(inputs[0])
 		if err != nil {
-			return nil, errors.Wrap(err, "parse function")
+			return "", errors.Wrap(err, "load unit")
 		}
-		ops = append(ops, op)
+		if u == "" {
+			return "", errors.Errorf("series %q has no unit", inputs[0])
+		}
+		return u, nil
+	}
+}
+
+func (p *Parser) compileStage(stage *PipeExpr, start time.Time, inputUnit func() (string, error)) (Operator, error) {
+	fn, ok := p.lookup(stage.Func)
+	if !ok {
+		return nil, &ParseError{Column: stage.Column, Msg: fmt.Sprintf("unknown function name %q", stage.Func)}
+	}
+
+	args, err := fn.bind(stage)
+	if err != nil {
+		return nil, err
 	}
+	args.inputUnit = inputUnit
 
-	return Chain{ops: ops}, nil
+	op, err := fn.New(start, args)
+	if err != nil {
+		return nil, &ParseError{Column: stage.Column, Msg: fmt.Sprintf("%s: %s", stage.Func, err)}
+	}
+	return op, nil
 }
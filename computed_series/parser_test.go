@@ -0,0 +1,171 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseCanonical(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"sample1 | gt 0.2 | avg 30s triangle", "sample1 | gt 0.2 | avg 30s triangle"},
+		{"sample1|gt 0.20|avg   30s  triangle", "sample1 | gt 0.2 | avg 30s triangle"},
+		{`"outdoor temp" | CtoF`, `"outdoor temp" | CtoF`},
+		{`'zone-1'`, "zone-1"},
+		{"a + b * c", "a + b * c"},
+		{"(a + b) * c", "(a + b) * c"},
+		{"a - (b - c)", "a - (b - c)"},
+		{"(a - b) - c", "a - b - c"},
+		{"-(a + b)", "-(a + b)"},
+		{"(a | avg 1m) - b", "(a | avg 1m) - b"},
+		{"interp(a * b) | avg 1m", "interp(a * b) | avg 1m"},
+		{"sum(a | add -1, b,c)", "sum(a | add -1, b, c)"},
+		{"a | avg 30s window=triangle", "a | avg 30s window=triangle"},
+		{`a | f label="x y"`, `a | f label="x y"`},
+		{"a * 1.8 + 32", "a * 1.8 + 32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseExpr(tt.expr)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, expr.String())
+
+			again, err := ParseExpr(expr.String())
+			require.NoError(t, err)
+			require.Equal(t, tt.want, again.String())
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr   string
+		column int
+		msg    string
+	}{
+		{"", 1, "empty expression"},
+		{"sample1 | foo 1", 11, `unknown function name "foo"`},
+		{"sample1 | gt x", 14, `gt: x: expected a number, got x`},
+		{"sample1 | gt", 11, `gt: missing argument "x"`},
+		{"sample1 | avg", 11, `avg: missing argument "duration"`},
+		{"sample1 | avg 0.5", 15, "avg: duration: expected a duration such as 30s"},
+		{"sample1 | avg 30s box", 19, "avg: window: expected one of flat, triangle"},
+		{"sample1 | avg 30s shape=box", 19, `avg: unknown argument "shape"`},
+		{"sample1 | gt 1 2", 16, "gt: too many arguments"},
+		{"sample1 | gt x=1 2", 18, "gt: positional argument after named argument"},
+		{"sample1 | avg 30s duration=1m", 19, `avg: argument "duration" given twice`},
+		{"sample1 |", 10, "expected name, found end of expression"},
+		{"(a + b", 7, `expected ")", found end of expression`},
+		{"sum(a b)", 7, `expected "," or ")", found "b"`},
+		{`"abc`, 1, "unterminated string"},
+		{"a # b", 3, `unexpected character '#'`},
+		{"median(a, b)", 1, `unknown combining function "median"`},
+		{"1 + 2", 3, "expression must reference a series"},
+		{"a * 5s", 5, `unexpected unit "s" in arithmetic`},
+		{"a | gt 1 b=", 12, "expected argument value, found end of expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := p.ParseNode(tt.expr, time.Time{})
+			require.Error(t, err)
+
+			perr, ok := err.(*ParseError)
+			require.True(t, ok, "%T: %v", err, err)
+			require.Equal(t, tt.column, perr.Column)
+			require.Contains(t, perr.Msg, tt.msg)
+		})
+	}
+}
+
+func TestParseConstants(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr string
+		want []float64
+	}{
+		{"temp * 1.8 + 32", []float64{32, 50}},
+		{"-temp", []float64{0, -10}},
+		{"100 / (temp + 10)", []float64{10, 5}},
+		{"temp * (2 - 1)", []float64{0, 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := p.ParseNode(tt.expr, time.Time{})
+			require.NoError(t, err)
+			require.Equal(t, []string{"temp"}, node.Inputs())
+
+			got := node.Process("temp", values(0, 0, 1, 10))
+			require.Len(t, got, len(tt.want))
+			for i, v := range got {
+				require.InDelta(t, tt.want[i], v.Value, 1e-9)
+			}
+		})
+	}
+}
+
+func TestParseLegacyNames(t *testing.T) {
+	known := map[string]bool{}
+	p := NewParser()
+	p.SetSeriesLookup(func(seriesName string) bool { return known[seriesName] })
+
+	// names that were valid before the expression grammar
+	for _, name := range []string{
+		"foo/bar",
+		`node_cpu{mode="idle"}`,
+		"a+b",
+		"x*y",
+		"temp°C",
+		"zone-1",
+	} {
+		known[name] = true
+
+		for _, expr := range []string{name, " " + name + " ", name + " | add 1", name + "|add 1|gt 0"} {
+			node, err := p.ParseNode(expr, time.Time{})
+			require.NoError(t, err, expr)
+			require.Equal(t, []string{name}, node.Inputs(), expr)
+		}
+
+		// the quoted form works without the lookup
+		node, err := NewParser().ParseNode(quoteName(name)+" | add 1", time.Time{})
+		require.NoError(t, err, name)
+		require.Equal(t, []string{name}, node.Inputs(), name)
+	}
+
+	// spaces keep the expression meaning
+	known["foo"], known["bar"] = true, true
+	node, err := p.ParseNode("foo / bar", time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"foo", "bar"}, node.Inputs())
+
+	// unknown bare names that do not parse ask for quotes
+	_, err = p.ParseNode(`node_mem{mode="free"} | add 1`, time.Time{})
+	require.ErrorContains(t, err, "quote series names")
+
+	_, err = p.ParseNode(`a | add x`, time.Time{})
+	require.NotContains(t, err.Error(), "quote series names")
+}
+
+func TestParseSingleSeries(t *testing.T) {
+	p := NewParser()
+
+	name, op, err := p.Parse("a | add 1", time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, "a", name)
+
+	out := op.ProcessNewValues([]schema.Value{{Timestamp: time.Unix(1, 0), Value: 2}})
+	require.Len(t, out, 1)
+	require.Equal(t, 3.0, out[0].Value)
+
+	_, _, err = p.Parse("a + b", time.Time{})
+	require.Error(t, err)
+}
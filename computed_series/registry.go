@@ -0,0 +1,257 @@
+package computed_series
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ArgType string
+
+const (
+	ArgDuration ArgType = "duration" // a number with a time unit, e.g. 30s
+	ArgFloat    ArgType = "float"    // a plain number
+	ArgInt      ArgType = "int"      // a whole number
+	ArgEnum     ArgType = "enum"     // one of Values
+	ArgString   ArgType = "string"   // any name, number or quoted string
+)
+
+// ArgSpec declares one argument of a pipeline function. Arguments with a
+// Default or marked Optional may be left out; required arguments must come
+// before optional ones.
+type ArgSpec struct {
+	Name        string   `json:"name"`
+	Type        ArgType  `json:"type"`
+	Values      []string `json:"values,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Optional    bool     `json:"optional,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+func (a ArgSpec) Required() bool {
+	return a.Default == "" && !a.Optional
+}
+
+// Function is a pipeline function such as avg or gt. New is only called with
+// arguments that have already been checked against Args. Operators get
+// values from before start too and should not drop them, the parser filters
+// the output of the whole expression.
+type Function struct {
+	Name        string                                             `json:"name"`
+	Description string                                             `json:"description,omitempty"`
+	Args        []ArgSpec                                          `json:"args"`
+	New         func(start time.Time, args Args) (Operator, error) `json:"-"`
+}
+
+func (f Function) validate() error {
+	if f.Name == "" {
+		return errors.New("function name is required")
+	}
+	if !isBareName(f.Name) {
+		return errors.Errorf("invalid function name %q", f.Name)
+	}
+	if f.New == nil {
+		return errors.Errorf("%s: New is required", f.Name)
+	}
+
+	seen := map[string]bool{}
+	optional := false
+	for _, spec := range f.Args {
+		if spec.Name == "" {
+			return errors.Errorf("%s: argument name is required", f.Name)
+		}
+		if seen[spec.Name] {
+			return errors.Errorf("%s: duplicate argument %q", f.Name, spec.Name)
+		}
+		seen[spec.Name] = true
+
+		switch spec.Type {
+		case ArgDuration, ArgFloat, ArgInt, ArgString:
+		case ArgEnum:
+			if len(spec.Values) == 0 {
+				return errors.Errorf("%s: enum argument %q has no values", f.Name, spec.Name)
+			}
+		default:
+			return errors.Errorf("%s: argument %q has unknown type %q", f.Name, spec.Name, spec.Type)
+		}
+
+		if spec.Required() && optional {
+			return errors.Errorf("%s: required argument %q follows an optional one", f.Name, spec.Name)
+		}
+		if !spec.Required() {
+			optional = true
+		}
+		if spec.Default != "" {
+			if _, err := convertArg(spec, spec.Default); err != nil {
+				return errors.Wrapf(err, "%s: default for %q", f.Name, spec.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Args holds the converted argument values of one function call
+type Args struct {
+	values    map[string]any
+	inputUnit func() (string, error)
+}
+
+// InputUnit is the unit of the values coming into the function, looked up on demand
+func (a Args) InputUnit() (string, error) {
+	if a.inputUnit == nil {
+		return "", errors.New("the unit of the input is not known")
+	}
+	return a.inputUnit()
+}
+
+func (a Args) Duration(name string) time.Duration {
+	v, _ := a.values[name].(time.Duration)
+	return v
+}
+
+func (a Args) Float(name string) float64 {
+	v, _ := a.values[name].(float64)
+	return v
+}
+
+func (a Args) Int(name string) int {
+	v, _ := a.values[name].(int)
+	return v
+}
+
+// Has reports whether an optional argument without a default was given
+func (a Args) Has(name string) bool {
+	_, ok := a.values[name]
+	return ok
+}
+
+// String returns enum and string arguments
+func (a Args) String(name string) string {
+	v, _ := a.values[name].(string)
+	return v
+}
+
+func convertArg(spec ArgSpec, raw string) (any, error) {
+	switch spec.Type {
+	case ArgDuration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, errors.Errorf("expected a duration such as 30s, got %q", raw)
+		}
+		if d <= 0 {
+			return nil, errors.Errorf("duration must be positive, got %q", raw)
+		}
+		return d, nil
+	case ArgFloat:
+		x, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errors.Errorf("expected a number, got %q", raw)
+		}
+		return x, nil
+	case ArgInt:
+		x, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errors.Errorf("expected a whole number, got %q", raw)
+		}
+		return x, nil
+	case ArgEnum:
+		if !slices.Contains(spec.Values, raw) {
+			return nil, errors.Errorf("expected one of %s, got %q", strings.Join(spec.Values, ", "), raw)
+		}
+		return raw, nil
+	case ArgString:
+		return raw, nil
+	}
+	return nil, errors.Errorf("unknown argument type %q", spec.Type)
+}
+
+func convertLiteral(spec ArgSpec, lit Literal) (any, error) {
+	if spec.Type == ArgFloat {
+		if lit.Kind != LiteralNumber || lit.Unit != "" {
+			return nil, errors.Errorf("expected a number, got %s", lit)
+		}
+		return lit.Value, nil
+	}
+	if spec.Type == ArgInt && (lit.Kind != LiteralNumber || lit.Unit != "" || lit.Value != math.Trunc(lit.Value)) {
+		return nil, errors.Errorf("expected a whole number, got %s", lit)
+	}
+	if spec.Type == ArgDuration && lit.Kind != LiteralNumber {
+		return nil, errors.Errorf("expected a duration such as 30s, got %s", lit)
+	}
+	return convertArg(spec, lit.Raw())
+}
+
+// bind matches the arguments of a pipeline stage to the function's schema.
+// Positional arguments fill Args in order, named arguments may follow them.
+func (f Function) bind(stage *PipeExpr) (Args, error) {
+	result := Args{values: map[string]any{}}
+	fail := func(column int, format string, a ...any) (Args, error) {
+		return Args{}, &ParseError{Column: column, Msg: f.Name + ": " + fmt.Sprintf(format, a...)}
+	}
+
+	named := false
+	for idx, arg := range stage.Args {
+		var spec ArgSpec
+
+		if arg.Name == "" {
+			if named {
+				return fail(arg.Column, "positional argument after named argument")
+			}
+			if idx >= len(f.Args) {
+				return fail(arg.Column, "too many arguments, expected at most %d", len(f.Args))
+			}
+			spec = f.Args[idx]
+		} else {
+			named = true
+			i := slices.IndexFunc(f.Args, func(s ArgSpec) bool { return s.Name == arg.Name })
+			if i < 0 {
+				return fail(arg.Column, "unknown argument %q", arg.Name)
+			}
+			spec = f.Args[i]
+		}
+
+		if _, ok := result.values[spec.Name]; ok {
+			return fail(arg.Column, "argument %q given twice", spec.Name)
+		}
+
+		v, err := convertLiteral(spec, arg.Value)
+		if err != nil {
+			return fail(arg.Column, "%s: %s", spec.Name, err)
+		}
+		result.values[spec.Name] = v
+	}
+
+	for _, spec := range f.Args {
+		if _, ok := result.values[spec.Name]; ok {
+			continue
+		}
+		if spec.Required() {
+			return fail(stage.Column, "missing argument %q", spec.Name)
+		}
+		if spec.Default == "" {
+			continue
+		}
+		v, _ := convertArg(spec, spec.Default)
+		result.values[spec.Name] = v
+	}
+
+	return result, nil
+}
+
+// Functions lists the available pipeline functions by name
+func (p *Parser) Functions() []Function {
+	result := make([]Function, 0, len(p.functions))
+	for _, fn := range p.functions {
+		result = append(result, fn)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,70 @@
+package computed_series
+
+import (
+	"github.com/stretchr/testify/require"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAddFunction(t *testing.T) {
+	p := NewParser()
+
+	err := p.AddFunction(Function{
+		Name: "scale",
+		Args: []ArgSpec{
+			{Name: "factor", Type: ArgFloat},
+			{Name: "offset", Type: ArgFloat, Default: "0"},
+		},
+		New: func(start time.Time, args Args) (Operator, error) {
+			return Chain{ops: []Operator{
+				OpScalar{Op: "*", X: args.Float("factor")},
+				OpAdd{X: args.Float("offset")},
+			}}, nil
+		},
+	})
+	require.NoError(t, err)
+
+	for expr, want := range map[string]float64{
+		"x | scale 2":          20,
+		"x | scale 2 1":        21,
+		"x | scale 2 offset=3": 23,
+		"x | scale factor=3":   30,
+	} {
+		node, err := p.ParseNode(expr, time.Time{})
+		require.NoError(t, err, expr)
+		got := node.Process("x", values(0, 10))
+		require.Equal(t, want, got[0].Value, expr)
+	}
+
+	// other parsers are unaffected
+	_, err = NewParser().ParseNode("x | scale 2", time.Time{})
+	require.Error(t, err)
+
+	var names []string
+	for _, fn := range p.Functions() {
+		names = append(names, fn.Name)
+	}
+	require.True(t, slices.IsSorted(names))
+	require.Contains(t, names, "avg")
+	require.Contains(t, names, "scale")
+}
+
+func TestAddFunctionInvalid(t *testing.T) {
+	newOp := func(start time.Time, args Args) (Operator, error) {
+		return OpCtoF{}, nil
+	}
+
+	for _, fn := range []Function{
+		{Name: "", New: newOp},
+		{Name: "a b", New: newOp},
+		{Name: "f"},
+		{Name: "f", New: newOp, Args: []ArgSpec{{Name: "x", Type: "bool"}}},
+		{Name: "f", New: newOp, Args: []ArgSpec{{Name: "x", Type: ArgEnum}}},
+		{Name: "f", New: newOp, Args: []ArgSpec{{Name: "x", Type: ArgFloat}, {Name: "x", Type: ArgFloat}}},
+		{Name: "f", New: newOp, Args: []ArgSpec{{Name: "x", Type: ArgFloat, Default: "1"}, {Name: "y", Type: ArgFloat}}},
+		{Name: "f", New: newOp, Args: []ArgSpec{{Name: "x", Type: ArgDuration, Default: "soon"}}},
+	} {
+		require.Error(t, NewParser().AddFunction(fn), "%+v", fn)
+	}
+}
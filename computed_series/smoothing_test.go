@@ -0,0 +1,92 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestEMA(t *testing.T) {
+	p := NewParser()
+
+	node, err := p.ParseNode("x | ema 10s", time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 100*time.Second, Lookback(node))
+
+	// a step from 0 to 1, sampled irregularly: the average only depends on
+	// elapsed time, not on how many samples arrived
+	got := node.Process("x", values(0, 0, 10, 1, 12, 1, 15, 1, 20, 1))
+	require.InDelta(t, 0.5, got[1].Value, 1e-9)
+	require.InDelta(t, 0.75, got[4].Value, 1e-9)
+
+	other, err := p.ParseNode("x | ema 10s", time.Time{})
+	require.NoError(t, err)
+	got = other.Process("x", values(0, 0, 10, 1, 20, 1))
+	require.InDelta(t, 0.75, got[2].Value, 1e-9)
+}
+
+func TestSavGol(t *testing.T) {
+	p := NewParser()
+
+	// a quadratic is reproduced exactly by a second order fit, even with
+	// irregular spacing
+	quadratic := func(x float64) float64 { return 0.5*x*x - 3*x + 2 }
+
+	rnd := rand.New(rand.NewSource(1))
+	var input []schema.Value
+	ts := 0.0
+	for i := 0; i < 100; i++ {
+		ts += 0.1 + rnd.Float64()
+		input = append(input, schema.Value{
+			Timestamp: time.Unix(0, int64(ts*float64(time.Second))),
+			Value:     quadratic(ts),
+		})
+	}
+
+	node, err := p.ParseNode("x | savgol 10s", time.Time{})
+	require.NoError(t, err)
+
+	for _, v := range node.Process("x", input)[3:] {
+		x := float64(v.Timestamp.UnixNano()) / float64(time.Second)
+		require.InDelta(t, quadratic(x), v.Value, 1e-6)
+	}
+
+	_, err = p.ParseNode("x | savgol 10s order=9", time.Time{})
+	require.Error(t, err)
+	_, err = p.ParseNode("x | savgol 10s order=1.5", time.Time{})
+	require.Error(t, err)
+}
+
+func TestKalman(t *testing.T) {
+	p := NewParser()
+
+	node, err := p.ParseNode("x | kalman 0.01 4", time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 200*time.Second, Lookback(node))
+
+	// noise with standard deviation 2 around 10
+	rnd := rand.New(rand.NewSource(1))
+	var input []schema.Value
+	for i := 0; i < 500; i++ {
+		input = append(input, schema.Value{
+			Timestamp: time.Unix(int64(i), 0),
+			Value:     10 + rnd.NormFloat64()*2,
+		})
+	}
+
+	got := node.Process("x", input)
+	require.Len(t, got, len(input))
+
+	var sq float64
+	for _, v := range got[100:] {
+		sq += (v.Value - 10) * (v.Value - 10)
+	}
+	rms := math.Sqrt(sq / float64(len(got)-100))
+	require.Less(t, rms, 0.7)
+
+	_, err = p.ParseNode("x | kalman 0 4", time.Time{})
+	require.Error(t, err)
+}
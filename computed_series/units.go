@@ -0,0 +1,152 @@
+package computed_series
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Unit converts to the base unit of its dimension by base = value*Scale + Offset
+type Unit struct {
+	Name      string
+	Dimension string
+	Scale     float64
+	Offset    float64
+}
+
+type unitDef struct {
+	dimension  string
+	scale      float64
+	offset     float64
+	prefixable bool // accepts SI prefixes, e.g. kW or mbar
+	binary     bool // also accepts binary prefixes, e.g. KiB
+}
+
+// base units: kelvin, pascal, metres per second, metre, joule, watt, byte
+var unitTable = map[string]unitDef{
+	"K":  {dimension: "temperature", scale: 1},
+	"C":  {dimension: "temperature", scale: 1, offset: 273.15},
+	"F":  {dimension: "temperature", scale: 5.0 / 9, offset: 273.15 - 32*5.0/9},
+	"°C": {dimension: "temperature", scale: 1, offset: 273.15},
+	"°F": {dimension: "temperature", scale: 5.0 / 9, offset: 273.15 - 32*5.0/9},
+
+	"Pa":   {dimension: "pressure", scale: 1, prefixable: true},
+	"bar":  {dimension: "pressure", scale: 1e5, prefixable: true},
+	"atm":  {dimension: "pressure", scale: 101325},
+	"psi":  {dimension: "pressure", scale: 6894.757293168},
+	"mmHg": {dimension: "pressure", scale: 133.322387415},
+	"inHg": {dimension: "pressure", scale: 3386.389},
+
+	"m/s":  {dimension: "speed", scale: 1},
+	"km/h": {dimension: "speed", scale: 1 / 3.6},
+	"kph":  {dimension: "speed", scale: 1 / 3.6},
+	"mph":  {dimension: "speed", scale: 0.44704},
+	"kn":   {dimension: "speed", scale: 1852.0 / 3600},
+	"ft/s": {dimension: "speed", scale: 0.3048},
+
+	"m":   {dimension: "distance", scale: 1, prefixable: true},
+	"in":  {dimension: "distance", scale: 0.0254},
+	"ft":  {dimension: "distance", scale: 0.3048},
+	"yd":  {dimension: "distance", scale: 0.9144},
+	"mi":  {dimension: "distance", scale: 1609.344},
+	"nmi": {dimension: "distance", scale: 1852},
+
+	"J":   {dimension: "energy", scale: 1, prefixable: true},
+	"Wh":  {dimension: "energy", scale: 3600, prefixable: true},
+	"cal": {dimension: "energy", scale: 4.184, prefixable: true},
+	"BTU": {dimension: "energy", scale: 1055.05585},
+
+	"W":  {dimension: "power", scale: 1, prefixable: true},
+	"hp": {dimension: "power", scale: 745.69987158227},
+
+	"B":   {dimension: "data", scale: 1, prefixable: true, binary: true},
+	"bit": {dimension: "data", scale: 0.125, prefixable: true, binary: true},
+}
+
+var siPrefixes = map[string]float64{
+	"p": 1e-12,
+	"n": 1e-9,
+	"u": 1e-6,
+	"µ": 1e-6,
+	"m": 1e-3,
+	"c": 1e-2,
+	"h": 1e2,
+	"k": 1e3,
+	"M": 1e6,
+	"G": 1e9,
+	"T": 1e12,
+	"P": 1e15,
+}
+
+var binaryPrefixes = map[string]float64{
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+	"Pi": 1 << 50,
+}
+
+// LookupUnit finds a unit by name, with an optional SI or binary prefix
+func LookupUnit(name string) (Unit, error) {
+	if def, ok := unitTable[name]; ok {
+		return Unit{Name: name, Dimension: def.dimension, Scale: def.scale, Offset: def.offset}, nil
+	}
+
+	for prefix, factor := range binaryPrefixes {
+		base, ok := strings.CutPrefix(name, prefix)
+		if def, found := unitTable[base]; ok && found && def.binary {
+			return Unit{Name: name, Dimension: def.dimension, Scale: def.scale * factor}, nil
+		}
+	}
+
+	for prefix, factor := range siPrefixes {
+		base, ok := strings.CutPrefix(name, prefix)
+		if def, found := unitTable[base]; ok && found && def.prefixable {
+			return Unit{Name: name, Dimension: def.dimension, Scale: def.scale * factor}, nil
+		}
+	}
+
+	return Unit{}, errors.Errorf("unknown unit %q", name)
+}
+
+// OpConvert converts values from one unit to another of the same dimension
+type OpConvert struct {
+	From Unit
+	To   Unit
+}
+
+func NewOpConvert(from, to string) (*OpConvert, error) {
+	f, err := LookupUnit(from)
+	if err != nil {
+		return nil, err
+	}
+	t, err := LookupUnit(to)
+	if err != nil {
+		return nil, err
+	}
+	if f.Dimension != t.Dimension {
+		return nil, errors.Errorf("can't convert %s (%s) to %s (%s)", from, f.Dimension, to, t.Dimension)
+	}
+	return &OpConvert{From: f, To: t}, nil
+}
+
+func (o *OpConvert) Convert(v float64) float64 {
+	base := v*o.From.Scale + o.From.Offset
+	return (base - o.To.Offset) / o.To.Scale
+}
+
+// OutputUnit is the unit of the converted values
+func (o *OpConvert) OutputUnit() string {
+	return o.To.Name
+}
+
+func (o *OpConvert) ProcessNewValues(values []schema.Value) []schema.Value {
+	result := make([]schema.Value, len(values))
+	for idx, value := range values {
+		result[idx] = schema.Value{
+			Timestamp: value.Timestamp,
+			Value:     o.Convert(value.Value),
+		}
+	}
+	return result
+}
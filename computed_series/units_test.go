@@ -0,0 +1,115 @@
+package computed_series
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestConvertUnits(t *testing.T) {
+	tests := []struct {
+		from, to string
+		in, want float64
+	}{
+		{"C", "F", 100, 212},
+		{"F", "C", 32, 0},
+		{"K", "C", 0, -273.15},
+		{"°C", "K", 20, 293.15},
+		{"W", "kW", 1500, 1.5},
+		{"kWh", "MJ", 1, 3.6},
+		{"hPa", "bar", 1013.25, 1.01325},
+		{"atm", "kPa", 1, 101.325},
+		{"km/h", "m/s", 36, 10},
+		{"mph", "kph", 1, 1.609344},
+		{"mi", "km", 1, 1.609344},
+		{"ft", "mm", 1, 304.8},
+		{"KiB", "B", 2, 2048},
+		{"MB", "kB", 1, 1000},
+		{"Mbit", "kB", 8, 1000},
+		{"kcal", "kJ", 1, 4.184},
+		{"mbar", "Pa", 1, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			op, err := NewOpConvert(tt.from, tt.to)
+			require.NoError(t, err)
+			require.InDelta(t, tt.want, op.Convert(tt.in), 1e-9)
+		})
+	}
+
+	for _, pair := range [][2]string{{"C", "kW"}, {"furlong", "m"}, {"kK", "C"}, {"KiW", "W"}} {
+		_, err := NewOpConvert(pair[0], pair[1])
+		require.Error(t, err, pair)
+	}
+}
+
+func TestConvertFunction(t *testing.T) {
+	p := NewParser()
+	p.SetUnitLookup(func(seriesName string) (string, error) {
+		switch seriesName {
+		case "temp":
+			return "C", nil
+		case "power":
+			return "W", nil
+		case "speed":
+			return "km/h", nil
+		case "broken":
+			return "", errors.New("db down")
+		}
+		return "", nil
+	})
+
+	tests := []struct {
+		expr string
+		unit string
+		want float64
+	}{
+		{"temp | convert C F", "F", 212},
+		{"temp | convert F", "F", 212},
+		{`"power" | convert kW`, "kW", 0.1},
+		{`power | convert "W" "MW" | add 1`, "MW", 1.0001},
+		{"temp | convert F | convert K", "K", 373.15},
+		{"(temp | convert F) * 2 | convert C", "C", 217.77777777777777},
+		{`speed | convert "km/h" "m/s"`, "m/s", 27.77777777777778},
+		{`speed | convert 'm/s'`, "m/s", 27.77777777777778},
+		{`temp | convert "°C" K`, "K", 373.15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := p.ParseNode(tt.expr, time.Time{})
+			require.NoError(t, err)
+
+			unit, ok := OutputUnit(node)
+			require.True(t, ok)
+			require.Equal(t, tt.unit, unit)
+
+			got := node.Process(node.Inputs()[0], values(0, 100))
+			require.InDelta(t, tt.want, got[0].Value, 1e-9)
+		})
+	}
+
+	for _, expr := range []string{
+		"other | convert F",  // no stored unit
+		"broken | convert F", // lookup failed
+		"temp + power | convert F",
+		"temp | convert kW",
+		// units with / or ° must be quoted
+		"speed | convert km/h m/s",
+		"temp | convert °C K",
+	} {
+		_, err := p.ParseNode(expr, time.Time{})
+		require.Error(t, err, expr)
+	}
+
+	// no lookup configured
+	_, err := NewParser().ParseNode("temp | convert F", time.Time{})
+	require.Error(t, err)
+
+	node, err := p.ParseNode("temp | avg 1m", time.Time{})
+	require.NoError(t, err)
+	_, ok := OutputUnit(node)
+	require.False(t, ok)
+}
@@ -20,6 +20,12 @@ func NewDatabaseManagerWrapper(dbManager js.Value) (*DatabaseManagerWrapper, err
 	return &DatabaseManagerWrapper{dbManager: dbManager}, nil
 }
 
+// has reports whether the JS dbManager implements method. Hosts built before
+// a method was added lack it, and calling it would panic.
+func (dmw *DatabaseManagerWrapper) has(method string) bool {
+	return dmw.dbManager.Get(method).Type() == js.TypeFunction
+}
+
 func printKeys(jsObject js.Value) {
 	// Get the keys of the object
 	keys := js.Global().Get("Object").Call("keys", jsObject)
@@ -99,6 +105,175 @@ func (dmw *DatabaseManagerWrapper) InsertValue(seriesName string, timestamp time
 	return nil
 }
 
+func (dmw *DatabaseManagerWrapper) InsertSeries(series schema.Series) error {
+	if len(series.Values) == 0 {
+		return nil
+	}
+
+	if !dmw.has("insertSeries") {
+		for _, v := range series.Values {
+			if err := dmw.InsertValue(series.SeriesName, v.Timestamp, v.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	timestamps := make([]any, len(series.Values))
+	values := make([]any, len(series.Values))
+	for i, v := range series.Values {
+		timestamps[i] = v.Timestamp.UnixMilli()
+		values[i] = v.Value
+	}
+
+	promise := dmw.dbManager.Call("insertSeries", series.SeriesName, timestamps, values)
+
+	result := await(promise)
+	if !result.Truthy() {
+		return fmt.Errorf("failed to insert series")
+	}
+
+	return nil
+}
+
+func (dmw *DatabaseManagerWrapper) DeleteBefore(seriesName string, cutoff time.Time) error {
+	promise := dmw.dbManager.Call("deleteBefore", seriesName, cutoff.UnixMilli())
+
+	result := await(promise)
+	if !result.Truthy() {
+		return fmt.Errorf("failed to delete values")
+	}
+
+	return nil
+}
+
+func (dmw *DatabaseManagerWrapper) SetMetadata(seriesName string, metadata schema.SeriesMetadata) error {
+	if !dmw.has("setMetadata") {
+		return fmt.Errorf("dbManager does not support metadata")
+	}
+
+	md := map[string]any{
+		"unit":        metadata.Unit,
+		"description": metadata.Description,
+		"color":       metadata.Color,
+	}
+	if metadata.Min != nil {
+		md["min"] = *metadata.Min
+	}
+	if metadata.Max != nil {
+		md["max"] = *metadata.Max
+	}
+
+	promise := dmw.dbManager.Call("setMetadata", seriesName, md)
+
+	result := await(promise)
+	if !result.Truthy() {
+		return fmt.Errorf("failed to set metadata")
+	}
+
+	return nil
+}
+
+// LoadMetadata returns zero metadata when the host does not store any
+func (dmw *DatabaseManagerWrapper) LoadMetadata(seriesName string) (schema.SeriesMetadata, error) {
+	if !dmw.has("loadMetadata") {
+		return schema.SeriesMetadata{}, nil
+	}
+
+	promise := dmw.dbManager.Call("loadMetadata", seriesName)
+
+	dbResult := await(promise)
+	if dbResult.IsUndefined() || dbResult.IsNull() {
+		return schema.SeriesMetadata{}, nil
+	}
+
+	optString := func(key string) string {
+		v := dbResult.Get(key)
+		if v.Type() != js.TypeString {
+			return ""
+		}
+		return v.String()
+	}
+
+	optFloat := func(key string) *float64 {
+		v := dbResult.Get(key)
+		if v.Type() != js.TypeNumber {
+			return nil
+		}
+		f := v.Float()
+		return &f
+	}
+
+	return schema.SeriesMetadata{
+		Unit:        optString("unit"),
+		Description: optString("description"),
+		Min:         optFloat("min"),
+		Max:         optFloat("max"),
+		Color:       optString("color"),
+	}, nil
+}
+
+// InsertMarker does nothing when the host cannot store markers, they are still
+// delivered to live subscribers
+func (dmw *DatabaseManagerWrapper) InsertMarker(marker schema.Marker) error {
+	if !dmw.has("insertMarker") {
+		return nil
+	}
+
+	promise := dmw.dbManager.Call(
+		"insertMarker",
+		marker.ID,
+		marker.Type,
+		marker.Ref,
+		marker.Timestamp.UnixMilli(),
+	)
+
+	result := await(promise)
+	if !result.Truthy() {
+		return fmt.Errorf("failed to insert marker")
+	}
+
+	return nil
+}
+
+func (dmw *DatabaseManagerWrapper) LoadMarkersAfter(start time.Time) ([]schema.Marker, error) {
+	if !dmw.has("loadMarkersAfter") {
+		return nil, nil
+	}
+	promise := dmw.dbManager.Call("loadMarkersAfter", start.UnixMilli())
+	return dmw.loadMarkers(promise)
+}
+
+func (dmw *DatabaseManagerWrapper) LoadMarkersBetween(start, end time.Time) ([]schema.Marker, error) {
+	if !dmw.has("loadMarkersBetween") {
+		return nil, nil
+	}
+	promise := dmw.dbManager.Call("loadMarkersBetween", start.UnixMilli(), end.UnixMilli())
+	return dmw.loadMarkers(promise)
+}
+
+func (dmw *DatabaseManagerWrapper) loadMarkers(promise js.Value) ([]schema.Marker, error) {
+	dbResult := await(promise)
+
+	if dbResult.IsUndefined() || dbResult.Type() != js.TypeObject {
+		return nil, fmt.Errorf("failed to load markers: result is undefined or not an object")
+	}
+
+	result := make([]schema.Marker, dbResult.Length())
+
+	for i := 0; i < dbResult.Length(); i++ {
+		row := dbResult.Index(i)
+		result[i] = schema.Marker{
+			ID:        row.Get("id").String(),
+			Type:      row.Get("type").String(),
+			Ref:       row.Get("ref").String(),
+			Timestamp: time.UnixMilli(int64(row.Get("timestamp").Int())),
+		}
+	}
+
+	return result, nil
+}
+
 func (dmw *DatabaseManagerWrapper) AllSeriesNames() ([]string, error) {
 	promise := dmw.dbManager.Call("allSeriesNames")
 	var result []string
@@ -2,13 +2,44 @@ package inmem
 
 import (
 	"github.com/minor-industries/rtgraph/schema"
+	"sort"
 	"sync"
 	"time"
 )
 
+// Limits bound how much history is kept for each series.
+type Limits struct {
+	Capacity int           // max points kept per series, zero is unbounded
+	MaxAge   time.Duration // drop points older than the newest point by more than MaxAge, zero keeps all
+}
+
 type Backend struct {
-	lock   sync.Mutex
-	values map[string][]schema.Value
+	lock     sync.Mutex
+	limits   Limits
+	values   map[string]*ring
+	metadata map[string]schema.SeriesMetadata
+	markers  []schema.Marker // ordered by timestamp
+}
+
+func NewBackend() *Backend {
+	return NewBackendWithLimits(Limits{})
+}
+
+func NewBackendWithLimits(limits Limits) *Backend {
+	return &Backend{
+		limits:   limits,
+		values:   map[string]*ring{},
+		metadata: map[string]schema.SeriesMetadata{},
+	}
+}
+
+func (b *Backend) series(seriesName string) *ring {
+	r, ok := b.values[seriesName]
+	if !ok {
+		r = newRing()
+		b.values[seriesName] = r
+	}
+	return r
 }
 
 func (b *Backend) LoadDataBetween(
@@ -16,14 +47,18 @@ func (b *Backend) LoadDataBetween(
 	start time.Time,
 	end time.Time,
 ) (schema.Series, error) {
-	//TODO implement me
-	panic("implement me")
-}
+	b.lock.Lock()
+	defer b.lock.Unlock()
 
-func NewBackend() *Backend {
-	return &Backend{
-		values: map[string][]schema.Value{},
+	var values []schema.Value
+	if r, ok := b.values[seriesName]; ok {
+		values = r.slice(r.search(start), r.search(end))
 	}
+
+	return schema.Series{
+		SeriesName: seriesName,
+		Values:     values,
+	}, nil
 }
 
 func (b *Backend) LoadDataAfter(
@@ -34,12 +69,10 @@ func (b *Backend) LoadDataAfter(
 	defer b.lock.Unlock()
 
 	var values []schema.Value
-	for _, value := range b.values[seriesName] {
-		if value.Timestamp.Before(start) {
-			continue
-		}
-		values = append(values, value)
+	if r, ok := b.values[seriesName]; ok {
+		values = r.slice(r.search(start), r.values.Len())
 	}
+
 	return schema.Series{
 		SeriesName: seriesName,
 		Values:     values,
@@ -47,9 +80,27 @@ func (b *Backend) LoadDataAfter(
 }
 
 func (b *Backend) CreateSeries(seriesNames []string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, name := range seriesNames {
+		b.series(name)
+	}
 	return nil
 }
 
+func (b *Backend) AllSeriesNames() ([]string, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	result := make([]string, 0, len(b.values))
+	for name := range b.values {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
 func (b *Backend) InsertValue(
 	seriesName string,
 	timestamp time.Time,
@@ -58,9 +109,95 @@ func (b *Backend) InsertValue(
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	b.values[seriesName] = append(b.values[seriesName], schema.Value{
+	r := b.series(seriesName)
+	r.insert(schema.Value{
 		Timestamp: timestamp,
 		Value:     value,
 	})
+	r.enforce(b.limits)
+	return nil
+}
+
+func (b *Backend) InsertSeries(series schema.Series) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r := b.series(series.SeriesName)
+	for _, value := range series.Values {
+		r.insert(value)
+	}
+	r.enforce(b.limits)
+	return nil
+}
+
+func (b *Backend) DeleteBefore(seriesName string, cutoff time.Time) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if r, ok := b.values[seriesName]; ok {
+		r.dropBefore(cutoff)
+	}
+	return nil
+}
+
+func (b *Backend) SetMetadata(seriesName string, metadata schema.SeriesMetadata) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.series(seriesName)
+	b.metadata[seriesName] = metadata
+	return nil
+}
+
+func (b *Backend) LoadMetadata(seriesName string) (schema.SeriesMetadata, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.metadata[seriesName], nil
+}
+
+func (b *Backend) InsertMarker(marker schema.Marker) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, m := range b.markers {
+		if m.ID == marker.ID {
+			return nil
+		}
+	}
+
+	// insert after any markers with the same timestamp
+	idx := sort.Search(len(b.markers), func(i int) bool {
+		return b.markers[i].Timestamp.After(marker.Timestamp)
+	})
+	b.markers = append(b.markers, schema.Marker{})
+	copy(b.markers[idx+1:], b.markers[idx:])
+	b.markers[idx] = marker
 	return nil
 }
+
+// searchMarkers returns the index of the first marker at or after t
+func (b *Backend) searchMarkers(t time.Time) int {
+	return sort.Search(len(b.markers), func(i int) bool {
+		return !b.markers[i].Timestamp.Before(t)
+	})
+}
+
+func (b *Backend) LoadMarkersAfter(start time.Time) ([]schema.Marker, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	lo := b.searchMarkers(start)
+	return append([]schema.Marker(nil), b.markers[lo:]...), nil
+}
+
+func (b *Backend) LoadMarkersBetween(start, end time.Time) ([]schema.Marker, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	lo, hi := b.searchMarkers(start), b.searchMarkers(end)
+	if hi <= lo {
+		return nil, nil
+	}
+	return append([]schema.Marker(nil), b.markers[lo:hi]...), nil
+}
@@ -0,0 +1,72 @@
+package inmem
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/minor-industries/rtgraph/storage"
+	"github.com/minor-industries/rtgraph/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func timestamps(series schema.Series) []int64 {
+	var result []int64
+	for _, v := range series.Values {
+		result = append(result, v.Timestamp.UnixMilli())
+	}
+	return result
+}
+
+func TestOutOfOrderInsert(t *testing.T) {
+	b := NewBackend()
+
+	for _, ts := range []int64{10, 30, 20, 0, 30, 40} {
+		require.NoError(t, b.InsertValue("s", time.UnixMilli(ts), float64(ts)))
+	}
+
+	all, err := b.LoadDataAfter("s", time.UnixMilli(0))
+	require.NoError(t, err)
+	require.Equal(t, []int64{0, 10, 20, 30, 40}, timestamps(all))
+
+	between, err := b.LoadDataBetween("s", time.UnixMilli(10), time.UnixMilli(30))
+	require.NoError(t, err)
+	require.Equal(t, []int64{10, 20}, timestamps(between))
+}
+
+func TestLimits(t *testing.T) {
+	b := NewBackendWithLimits(Limits{
+		Capacity: 5,
+		MaxAge:   3 * time.Second,
+	})
+
+	var values []schema.Value
+	for i := 0; i < 10; i++ {
+		values = append(values, schema.Value{
+			Timestamp: time.UnixMilli(int64(i) * 500),
+			Value:     float64(i),
+		})
+	}
+	require.NoError(t, b.InsertSeries(schema.Series{SeriesName: "cap", Values: values}))
+
+	capped, err := b.LoadDataAfter("cap", time.UnixMilli(0))
+	require.NoError(t, err)
+	require.Equal(t, []int64{2500, 3000, 3500, 4000, 4500}, timestamps(capped))
+
+	require.NoError(t, b.InsertValue("cap", time.UnixMilli(7000), 0))
+
+	aged, err := b.LoadDataAfter("cap", time.UnixMilli(0))
+	require.NoError(t, err)
+	require.Equal(t, []int64{4000, 4500, 7000}, timestamps(aged))
+
+	names, err := b.AllSeriesNames()
+	require.NoError(t, err)
+	require.Equal(t, []string{"cap"}, names)
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, storagetest.Harness{
+		New: func(t *testing.T) storage.StorageBackend {
+			return NewBackend()
+		},
+	})
+}
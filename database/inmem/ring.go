@@ -0,0 +1,72 @@
+package inmem
+
+import (
+	"github.com/gammazero/deque"
+	"github.com/minor-industries/rtgraph/schema"
+	"sort"
+	"time"
+)
+
+// ring holds the values of one series ordered by timestamp. Old values are
+// dropped from the front as limits are exceeded.
+type ring struct {
+	values *deque.Deque[schema.Value]
+}
+
+func newRing() *ring {
+	return &ring{
+		values: deque.New[schema.Value](0, 64),
+	}
+}
+
+// search returns the index of the first value at or after t
+func (r *ring) search(t time.Time) int {
+	return sort.Search(r.values.Len(), func(i int) bool {
+		return !r.values.At(i).Timestamp.Before(t)
+	})
+}
+
+func (r *ring) slice(lo, hi int) []schema.Value {
+	if hi <= lo {
+		return nil
+	}
+	result := make([]schema.Value, hi-lo)
+	for i := range result {
+		result[i] = r.values.At(lo + i)
+	}
+	return result
+}
+
+// insert keeps values sorted; a value with an existing timestamp is ignored
+func (r *ring) insert(v schema.Value) {
+	n := r.values.Len()
+	if n == 0 || r.values.Back().Timestamp.Before(v.Timestamp) {
+		// fast path for in-order data
+		r.values.PushBack(v)
+		return
+	}
+
+	idx := r.search(v.Timestamp)
+	if idx < n && r.values.At(idx).Timestamp.Equal(v.Timestamp) {
+		return
+	}
+	r.values.Insert(idx, v)
+}
+
+func (r *ring) dropBefore(cutoff time.Time) {
+	for r.values.Len() > 0 && r.values.Front().Timestamp.Before(cutoff) {
+		r.values.PopFront()
+	}
+}
+
+func (r *ring) enforce(limits Limits) {
+	if limits.Capacity > 0 {
+		for r.values.Len() > limits.Capacity {
+			r.values.PopFront()
+		}
+	}
+
+	if limits.MaxAge > 0 && r.values.Len() > 0 {
+		r.dropBefore(r.values.Back().Timestamp.Add(-limits.MaxAge))
+	}
+}
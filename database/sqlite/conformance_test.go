@@ -0,0 +1,31 @@
+//go:build !wasm
+
+package sqlite
+
+import (
+	"github.com/minor-industries/rtgraph/storage"
+	"github.com/minor-industries/rtgraph/storage/storagetest"
+	"path/filepath"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, storagetest.Harness{
+		New: func(t *testing.T) storage.StorageBackend {
+			b, err := Get(filepath.Join(t.TempDir(), "conformance.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			go b.RunWriter(nil)
+			t.Cleanup(func() {
+				if err := b.Close(); err != nil {
+					t.Error(err)
+				}
+			})
+			return b
+		},
+		Sync: func(t *testing.T, backend storage.StorageBackend) {
+			backend.(*Backend).Flush()
+		},
+	})
+}
@@ -16,10 +16,14 @@ func Get(filename string) (*Backend, error) {
 		return nil, errors.Wrap(err, "open")
 	}
 
+	// databases written before rollups existed get them computed once
+	backfill := !db.Migrator().HasTable(&Rollup{})
+
 	for _, table := range []any{
 		&Sample{},
 		&Series{},
 		&Marker{},
+		&Rollup{},
 	} {
 		err = db.AutoMigrate(table)
 		if err != nil {
@@ -27,6 +31,12 @@ func Get(filename string) (*Backend, error) {
 		}
 	}
 
+	if backfill {
+		if err := backfillRollups(db); err != nil {
+			return nil, errors.Wrap(err, "backfill rollups")
+		}
+	}
+
 	return NewBackend(db, 100), nil
 }
 
@@ -82,6 +92,133 @@ func (b *Backend) InsertValue(seriesName string, timestamp time.Time, value floa
 	return nil
 }
 
+// maxBatchRows bounds the number of rows in a single multi-row INSERT so that
+// large batches stay under sqlite's limit on bound variables.
+const maxBatchRows = 500
+
+func (b *Backend) InsertSeries(series schema.Series) error {
+	if len(series.Values) == 0 {
+		return nil
+	}
+
+	seriesID := HashedID(series.SeriesName)
+
+	b.Insert(&Series{
+		ID:   seriesID,
+		Name: series.SeriesName,
+	})
+
+	// send whole chunks through the writer so that a large batch costs a handful
+	// of channel sends instead of one per point
+	for lo := 0; lo < len(series.Values); lo += maxBatchRows {
+		hi := min(lo+maxBatchRows, len(series.Values))
+		samples := make([]Sample, 0, hi-lo)
+		for _, v := range series.Values[lo:hi] {
+			samples = append(samples, Sample{
+				SeriesID:  seriesID,
+				Timestamp: v.Timestamp.UnixMilli(),
+				Value:     v.Value,
+			})
+		}
+		b.Insert(&samples)
+	}
+
+	return nil
+}
+
+func (b *Backend) DeleteBefore(seriesName string, cutoff time.Time) error {
+	// routed through the writer so deletes are serialized with pending inserts
+	b.Delete(&deleteSamples{
+		seriesID: HashedID(seriesName),
+		before:   cutoff.UnixMilli(),
+	})
+	return nil
+}
+
+func (b *Backend) SetMetadata(seriesName string, metadata schema.SeriesMetadata) error {
+	b.Save(&Series{
+		ID:          HashedID(seriesName),
+		Name:        seriesName,
+		Unit:        metadata.Unit,
+		Description: metadata.Description,
+		Min:         metadata.Min,
+		Max:         metadata.Max,
+		Color:       metadata.Color,
+	})
+	return nil
+}
+
+func (b *Backend) LoadMetadata(seriesName string) (schema.SeriesMetadata, error) {
+	var rows []Series
+	tx := b.db.Where("id = ?", HashedID(seriesName)).Limit(1).Find(&rows)
+	if tx.Error != nil {
+		return schema.SeriesMetadata{}, errors.Wrap(tx.Error, "find")
+	}
+
+	if len(rows) == 0 {
+		return schema.SeriesMetadata{}, nil
+	}
+
+	row := rows[0]
+	return schema.SeriesMetadata{
+		Unit:        row.Unit,
+		Description: row.Description,
+		Min:         row.Min,
+		Max:         row.Max,
+		Color:       row.Color,
+	}, nil
+}
+
+func (b *Backend) InsertMarker(marker schema.Marker) error {
+	b.Insert(&Marker{
+		ID:        marker.ID,
+		Type:      marker.Type,
+		Ref:       marker.Ref,
+		Timestamp: marker.Timestamp.UnixMilli(),
+	})
+	return nil
+}
+
+func (b *Backend) LoadMarkersBetween(start, end time.Time) ([]schema.Marker, error) {
+	q := b.db.Where(
+		"timestamp >= ? and timestamp < ?",
+		start.UnixMilli(),
+		end.UnixMilli(),
+	)
+
+	return b.loadMarkers(q)
+}
+
+func (b *Backend) LoadMarkersAfter(start time.Time) ([]schema.Marker, error) {
+	q := b.db.Where(
+		"timestamp >= ?",
+		start.UnixMilli(),
+	)
+
+	return b.loadMarkers(q)
+}
+
+func (b *Backend) loadMarkers(query *gorm.DB) ([]schema.Marker, error) {
+	var rows []Marker
+
+	tx := query.Order("timestamp asc").Find(&rows)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "find")
+	}
+
+	result := make([]schema.Marker, len(rows))
+	for idx, row := range rows {
+		result[idx] = schema.Marker{
+			ID:        row.ID,
+			Type:      row.Type,
+			Ref:       row.Ref,
+			Timestamp: time.UnixMilli(row.Timestamp),
+		}
+	}
+
+	return result, nil
+}
+
 func NewBackend(
 	db *gorm.DB,
 	bufSize int,
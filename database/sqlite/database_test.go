@@ -0,0 +1,37 @@
+//go:build !wasm
+
+package sqlite
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInsertSeriesChunks(t *testing.T) {
+	b, err := Get(filepath.Join(t.TempDir(), "chunks.db"))
+	require.NoError(t, err)
+
+	t0 := time.UnixMilli(0)
+	n := 2*maxBatchRows + 1
+	var values []schema.Value
+	for i := 0; i < n; i++ {
+		values = append(values, schema.Value{
+			Timestamp: t0.Add(time.Duration(i) * time.Second),
+			Value:     float64(i),
+		})
+	}
+
+	require.NoError(t, b.InsertSeries(schema.Series{SeriesName: "s1", Values: values}))
+	// the series row, then two full chunks and one with the last point
+	require.Len(t, b.objects, 4)
+	drain(t, b)
+
+	loaded, err := b.LoadDataAfter("s1", t0)
+	require.NoError(t, err)
+	require.Len(t, loaded.Values, n)
+	require.Equal(t, values[maxBatchRows-1:maxBatchRows+1], loaded.Values[maxBatchRows-1:maxBatchRows+1])
+	require.Equal(t, values[n-1], loaded.Values[n-1])
+}
@@ -13,7 +13,8 @@ import (
 	"gorm.io/gorm"
 )
 
-type Sample struct {
+// legacySample is the pre-migration layout of the samples table
+type legacySample struct {
 	Id          []byte `gorm:"primaryKey"`
 	SeriesID    []byte
 	Timestamp   time.Time
@@ -21,15 +22,19 @@ type Sample struct {
 	TimestampMS int64
 }
 
+func (legacySample) TableName() string {
+	return "samples"
+}
+
 func TestUpdateTimestampMS(t *testing.T) {
 	t.Skip()
 	db, err := gorm.Open(sqlite.Open(os.ExpandEnv("$HOME/z2.db")), &gorm.Config{})
 	require.NoError(t, err)
 
-	err = db.AutoMigrate(&Sample{})
+	err = db.AutoMigrate(&legacySample{})
 	require.NoError(t, err)
 
-	var samples []Sample
+	var samples []legacySample
 	err = db.Find(&samples).Error
 	fmt.Println(len(samples))
 	require.NoError(t, err)
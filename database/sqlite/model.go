@@ -6,10 +6,26 @@ type Sample struct {
 	Value     float64
 }
 
+// Rollup holds aggregates of the samples of one series within a time bucket.
+// Buckets are filled in by the writer as samples are inserted.
+type Rollup struct {
+	SeriesID   []byte `gorm:"primaryKey"`
+	Resolution int64  `gorm:"primaryKey"` // bucket width in milliseconds
+	Timestamp  int64  `gorm:"primaryKey"` // bucket start in milliseconds
+	Min        float64
+	Max        float64
+	Sum        float64
+	Count      int64
+}
+
 type Series struct {
-	ID   []byte `gorm:"primary_key"`
-	Name string `gorm:"unique"`
-	Unit string
+	ID          []byte `gorm:"primary_key"`
+	Name        string `gorm:"unique"`
+	Unit        string
+	Description string
+	Min         *float64
+	Max         *float64
+	Color       string
 }
 
 type Marker struct {
@@ -0,0 +1,244 @@
+//go:build !wasm
+
+package sqlite
+
+import (
+	"fmt"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// rollupTiers are the bucket widths maintained for every series, finest first.
+// Each tier is computed from the one before it, so every width must be a
+// multiple of the previous one.
+var rollupTiers = []time.Duration{time.Minute, time.Hour}
+
+type bucketKey struct {
+	seriesID  string
+	timestamp int64 // start of the bucket in the finest tier
+}
+
+func floorMs(ts int64, resolution int64) int64 {
+	r := ts % resolution
+	if r < 0 {
+		r += resolution
+	}
+	return ts - r
+}
+
+// dirtyBuckets returns the finest-tier buckets touched by a batch of writer objects
+func dirtyBuckets(objects []object) map[bucketKey]struct{} {
+	finest := rollupTiers[0].Milliseconds()
+	result := map[bucketKey]struct{}{}
+
+	add := func(seriesID []byte, ts int64) {
+		result[bucketKey{
+			seriesID:  string(seriesID),
+			timestamp: floorMs(ts, finest),
+		}] = struct{}{}
+	}
+
+	for _, row := range objects {
+		switch obj := row.obj.(type) {
+		case *Sample:
+			add(obj.SeriesID, obj.Timestamp)
+		case *[]Sample:
+			for _, sample := range *obj {
+				add(sample.SeriesID, sample.Timestamp)
+			}
+		case *deleteSamples:
+			// fully expired buckets are dropped with the samples, only the
+			// bucket straddling the cutoff needs recomputing
+			add(obj.seriesID, obj.before)
+		}
+	}
+
+	return result
+}
+
+func updateRollups(tx *gorm.DB, dirty map[bucketKey]struct{}) error {
+	for tier, resolution := range rollupTiers {
+		res := resolution.Milliseconds()
+
+		buckets := map[bucketKey]struct{}{}
+		for key := range dirty {
+			buckets[bucketKey{
+				seriesID:  key.seriesID,
+				timestamp: floorMs(key.timestamp, res),
+			}] = struct{}{}
+		}
+
+		for key := range buckets {
+			var err error
+			if tier == 0 {
+				err = recomputeFromSamples(tx, key, res)
+			} else {
+				err = recomputeFromRollups(tx, key, res, rollupTiers[tier-1].Milliseconds())
+			}
+			if err != nil {
+				return errors.Wrapf(err, "update %s rollup", resolution)
+			}
+		}
+	}
+
+	return nil
+}
+
+// backfillRollups computes every tier from the stored samples
+func backfillRollups(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for tier, resolution := range rollupTiers {
+			res := resolution.Milliseconds()
+			bucket := fmt.Sprintf("(timestamp - ((timestamp %% %d) + %d) %% %d)", res, res, res)
+
+			var err error
+			if tier == 0 {
+				err = tx.Exec(`insert or replace into rollups (series_id, resolution, timestamp, min, max, sum, count)
+					select series_id, ?, `+bucket+`, min(value), max(value), sum(value), count(*)
+					from samples group by series_id, `+bucket, res).Error
+			} else {
+				err = tx.Exec(`insert or replace into rollups (series_id, resolution, timestamp, min, max, sum, count)
+					select series_id, ?, `+bucket+`, min(min), max(max), sum(sum), sum(count)
+					from rollups where resolution = ? group by series_id, `+bucket,
+					res, rollupTiers[tier-1].Milliseconds()).Error
+			}
+			if err != nil {
+				return errors.Wrapf(err, "%s rollups", resolution)
+			}
+		}
+		return nil
+	})
+}
+
+type aggregate struct {
+	Min   float64
+	Max   float64
+	Sum   float64
+	Count int64
+}
+
+func recomputeFromSamples(tx *gorm.DB, key bucketKey, res int64) error {
+	var agg aggregate
+	err := tx.Model(&Sample{}).
+		Select("min(value) as min, max(value) as max, sum(value) as sum, count(*) as count").
+		Where(
+			"series_id = ? and timestamp >= ? and timestamp < ?",
+			[]byte(key.seriesID),
+			key.timestamp,
+			key.timestamp+res,
+		).
+		Scan(&agg).Error
+	if err != nil {
+		return errors.Wrap(err, "aggregate samples")
+	}
+
+	return saveRollup(tx, key, res, agg)
+}
+
+func recomputeFromRollups(tx *gorm.DB, key bucketKey, res int64, finerRes int64) error {
+	var agg aggregate
+	err := tx.Model(&Rollup{}).
+		Select("min(min) as min, max(max) as max, sum(sum) as sum, coalesce(sum(count), 0) as count").
+		Where(
+			"series_id = ? and resolution = ? and timestamp >= ? and timestamp < ?",
+			[]byte(key.seriesID),
+			finerRes,
+			key.timestamp,
+			key.timestamp+res,
+		).
+		Scan(&agg).Error
+	if err != nil {
+		return errors.Wrap(err, "aggregate rollups")
+	}
+
+	return saveRollup(tx, key, res, agg)
+}
+
+func saveRollup(tx *gorm.DB, key bucketKey, res int64, agg aggregate) error {
+	row := &Rollup{
+		SeriesID:   []byte(key.seriesID),
+		Resolution: res,
+		Timestamp:  key.timestamp,
+		Min:        agg.Min,
+		Max:        agg.Max,
+		Sum:        agg.Sum,
+		Count:      agg.Count,
+	}
+
+	if agg.Count == 0 {
+		return tx.Delete(row).Error
+	}
+
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(row).Error
+}
+
+func deleteExpiredRollups(tx *gorm.DB, d *deleteSamples) *gorm.DB {
+	return tx.Where(
+		"series_id = ? and timestamp + resolution <= ?",
+		d.seriesID,
+		d.before,
+	).Delete(&Rollup{})
+}
+
+// RollupResolutions lists the bucket widths available to LoadRollupAfter and LoadRollupBetween
+func (b *Backend) RollupResolutions() []time.Duration {
+	return rollupTiers
+}
+
+func (b *Backend) LoadRollupBetween(
+	seriesName string,
+	resolution time.Duration,
+	start time.Time,
+	end time.Time,
+) (schema.Series, error) {
+	q := b.db.Where(
+		"series_id = ? and resolution = ? and timestamp >= ? and timestamp < ?",
+		HashedID(seriesName),
+		resolution.Milliseconds(),
+		start.UnixMilli(),
+		end.UnixMilli(),
+	)
+
+	return b.loadRollupWindow(seriesName, q)
+}
+
+func (b *Backend) LoadRollupAfter(
+	seriesName string,
+	resolution time.Duration,
+	start time.Time,
+) (schema.Series, error) {
+	q := b.db.Where(
+		"series_id = ? and resolution = ? and timestamp >= ?",
+		HashedID(seriesName),
+		resolution.Milliseconds(),
+		start.UnixMilli(),
+	)
+
+	return b.loadRollupWindow(seriesName, q)
+}
+
+func (b *Backend) loadRollupWindow(seriesName string, query *gorm.DB) (schema.Series, error) {
+	var rows []Rollup
+
+	tx := query.Order("timestamp asc").Find(&rows)
+	if tx.Error != nil {
+		return schema.Series{}, errors.Wrap(tx.Error, "find")
+	}
+
+	result := schema.Series{
+		SeriesName: seriesName,
+	}
+	result.Values = make([]schema.Value, len(rows))
+
+	for idx, row := range rows {
+		result.Values[idx] = schema.Value{
+			Timestamp: time.UnixMilli(row.Timestamp),
+			Value:     row.Sum / float64(row.Count),
+		}
+	}
+
+	return result, nil
+}
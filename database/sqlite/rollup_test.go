@@ -0,0 +1,104 @@
+//go:build !wasm
+
+package sqlite
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func drain(t *testing.T, b *Backend) {
+	var rows []object
+	for len(b.objects) > 0 {
+		rows = append(rows, <-b.objects)
+	}
+	require.NoError(t, b.insert(rows))
+}
+
+func TestRollups(t *testing.T) {
+	b, err := Get(filepath.Join(t.TempDir(), "rollup.db"))
+	require.NoError(t, err)
+
+	t0 := time.UnixMilli(0)
+	var values []schema.Value
+	for i := 0; i < 120; i++ {
+		values = append(values, schema.Value{
+			Timestamp: t0.Add(time.Duration(i) * time.Second),
+			Value:     float64(i),
+		})
+	}
+
+	require.NoError(t, b.InsertSeries(schema.Series{SeriesName: "s1", Values: values[:90]}))
+	drain(t, b)
+	// overlapping batch, duplicates must not be counted twice
+	require.NoError(t, b.InsertSeries(schema.Series{SeriesName: "s1", Values: values[60:]}))
+	drain(t, b)
+
+	minutes, err := b.LoadRollupAfter("s1", time.Minute, t0)
+	require.NoError(t, err)
+	require.Equal(t, []schema.Value{
+		{Timestamp: t0, Value: 29.5},
+		{Timestamp: t0.Add(time.Minute), Value: 89.5},
+	}, minutes.Values)
+
+	hours, err := b.LoadRollupBetween("s1", time.Hour, t0, t0.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []schema.Value{
+		{Timestamp: t0, Value: 59.5},
+	}, hours.Values)
+
+	require.NoError(t, b.DeleteBefore("s1", t0.Add(90*time.Second)))
+	drain(t, b)
+
+	minutes, err = b.LoadRollupAfter("s1", time.Minute, t0)
+	require.NoError(t, err)
+	require.Equal(t, []schema.Value{
+		{Timestamp: t0.Add(time.Minute), Value: 104.5},
+	}, minutes.Values)
+}
+
+func TestBackfillRollups(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "backfill.db")
+	b, err := Get(filename)
+	require.NoError(t, err)
+
+	// two days of samples every ten minutes, then forget the rollups as if
+	// the database was written before they existed
+	t0 := time.UnixMilli(0)
+	var values []schema.Value
+	for i := 0; i < 2*24*6; i++ {
+		values = append(values, schema.Value{
+			Timestamp: t0.Add(time.Duration(i) * 10 * time.Minute),
+			Value:     float64(i),
+		})
+	}
+	require.NoError(t, b.InsertSeries(schema.Series{SeriesName: "s1", Values: values}))
+	drain(t, b)
+	require.NoError(t, b.db.Migrator().DropTable(&Rollup{}))
+	go b.RunWriter(nil)
+	require.NoError(t, b.Close())
+
+	b, err = Get(filename)
+	require.NoError(t, err)
+
+	end := t0.Add(48 * time.Hour)
+	minutes, err := b.LoadRollupBetween("s1", time.Minute, t0, end)
+	require.NoError(t, err)
+	require.Len(t, minutes.Values, len(values))
+	require.Equal(t, values[100], minutes.Values[100])
+
+	hours, err := b.LoadRollupBetween("s1", time.Hour, t0, end)
+	require.NoError(t, err)
+	require.Len(t, hours.Values, 48)
+	require.Equal(t, schema.Value{Timestamp: t0.Add(time.Hour), Value: 8.5}, hours.Values[1])
+
+	// new writes keep them up to date
+	require.NoError(t, b.InsertValue("s1", end, 1000))
+	drain(t, b)
+	hours, err = b.LoadRollupAfter("s1", time.Hour, end)
+	require.NoError(t, err)
+	require.Equal(t, []schema.Value{{Timestamp: end, Value: 1000}}, hours.Values)
+}
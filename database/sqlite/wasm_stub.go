@@ -25,6 +25,34 @@ func (d Backend) InsertValue(seriesName string, timestamp time.Time, value float
 	panic("not implemented")
 }
 
+func (d Backend) InsertSeries(series schema.Series) error {
+	panic("not implemented")
+}
+
+func (d Backend) DeleteBefore(seriesName string, cutoff time.Time) error {
+	panic("not implemented")
+}
+
+func (d Backend) SetMetadata(seriesName string, metadata schema.SeriesMetadata) error {
+	panic("not implemented")
+}
+
+func (d Backend) LoadMetadata(seriesName string) (schema.SeriesMetadata, error) {
+	panic("not implemented")
+}
+
+func (d Backend) InsertMarker(marker schema.Marker) error {
+	panic("not implemented")
+}
+
+func (d Backend) LoadMarkersAfter(start time.Time) ([]schema.Marker, error) {
+	panic("not implemented")
+}
+
+func (d Backend) LoadMarkersBetween(start, end time.Time) ([]schema.Marker, error) {
+	panic("not implemented")
+}
+
 func Get(string) (Backend, error) {
 	panic("not implemented")
 }
@@ -43,6 +71,14 @@ func (d Backend) RunWriter(chan error) error {
 	panic("not implemented")
 }
 
+func (d Backend) Flush() {
+	panic("not implemented")
+}
+
+func (d Backend) Close() error {
+	panic("not implemented")
+}
+
 func (d Backend) GetORM() ORM {
 	panic("not implemented")
 }
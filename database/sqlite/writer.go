@@ -11,7 +11,13 @@ import (
 
 type object struct {
 	obj       any
-	operation string // {insert, save}
+	operation string // {insert, save, delete, flush, stop}
+}
+
+// deleteSamples removes all samples of a series older than a timestamp
+type deleteSamples struct {
+	seriesID []byte
+	before   int64
 }
 
 func (b *Backend) Insert(obj any) {
@@ -28,6 +34,41 @@ func (b *Backend) Save(obj any) {
 	}
 }
 
+func (b *Backend) Delete(obj *deleteSamples) {
+	b.objects <- object{
+		obj:       obj,
+		operation: "delete",
+	}
+}
+
+// Flush blocks until every object queued before it has been written.
+// RunWriter must be running.
+func (b *Backend) Flush() {
+	done := make(chan struct{})
+	b.objects <- object{
+		obj:       done,
+		operation: "flush",
+	}
+	<-done
+}
+
+// Close writes everything queued, stops RunWriter and closes the database.
+// RunWriter must be running.
+func (b *Backend) Close() error {
+	done := make(chan struct{})
+	b.objects <- object{
+		obj:       done,
+		operation: "stop",
+	}
+	<-done
+
+	sqlDB, err := b.db.DB()
+	if err != nil {
+		return errors.Wrap(err, "get db")
+	}
+	return errors.Wrap(sqlDB.Close(), "close")
+}
+
 func (b *Backend) insert(objects []object) error {
 	err := b.db.Transaction(func(tx *gorm.DB) error {
 		for _, row := range objects {
@@ -37,6 +78,16 @@ func (b *Backend) insert(objects []object) error {
 				res = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(row.obj)
 			case "save":
 				res = tx.Save(row.obj)
+			case "delete":
+				d := row.obj.(*deleteSamples)
+				res = tx.Where(
+					"series_id = ? and timestamp < ?",
+					d.seriesID,
+					d.before,
+				).Delete(&Sample{})
+				if res.Error == nil {
+					res = deleteExpiredRollups(tx, d)
+				}
 			default:
 				return errors.New("unknown operation")
 			}
@@ -44,20 +95,39 @@ func (b *Backend) insert(objects []object) error {
 				return errors.Wrap(res.Error, row.operation)
 			}
 		}
-		return nil
+		return errors.Wrap(updateRollups(tx, dirtyBuckets(objects)), "rollups")
 	})
 	return err
 }
 
 func (b *Backend) RunWriter(errCh chan error) {
 	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
 
 	var rows []object
 
 	for {
 		select {
 		case obj := <-b.objects:
-			rows = append(rows, obj)
+			if obj.operation != "flush" && obj.operation != "stop" {
+				rows = append(rows, obj)
+				continue
+			}
+
+			var err error
+			if len(rows) > 0 {
+				err = b.insert(rows)
+				rows = nil
+			}
+			close(obj.obj.(chan struct{}))
+
+			if err != nil {
+				b.writerFailed(errCh, err)
+				return
+			}
+			if obj.operation == "stop" {
+				return
+			}
 		case <-ticker.C:
 			if len(rows) == 0 {
 				continue
@@ -67,13 +137,17 @@ func (b *Backend) RunWriter(errCh chan error) {
 			rows = nil
 
 			if err != nil {
-				err = errors.Wrap(err, "transaction")
-				if errCh == nil {
-					panic(err)
-				}
-				errCh <- err
+				b.writerFailed(errCh, err)
 				return
 			}
 		}
 	}
 }
+
+func (b *Backend) writerFailed(errCh chan error, err error) {
+	err = errors.Wrap(err, "transaction")
+	if errCh == nil {
+		panic(err)
+	}
+	errCh <- err
+}
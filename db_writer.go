@@ -12,13 +12,14 @@ func (g *Graph) publishToDB() {
 	for msg := range msgCh {
 		switch m := msg.(type) {
 		case schema.Series:
-			// TODO: figure out how to pass a slice to Insert()
-			for _, value := range m.Values {
-				err := g.db.InsertValue(m.SeriesName, value.Timestamp, value.Value)
-				if err != nil {
-					g.errCh <- errors.Wrap(err, "insert value to db")
-					return
-				}
+			if err := g.db.InsertSeries(m); err != nil {
+				g.errCh <- errors.Wrap(err, "insert series to db")
+				return
+			}
+		case schema.Marker:
+			if err := g.db.InsertMarker(m); err != nil {
+				g.errCh <- errors.Wrap(err, "insert marker to db")
+				return
 			}
 		}
 	}
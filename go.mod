@@ -3,15 +3,16 @@ module github.com/minor-industries/rtgraph
 go 1.21.1
 
 require (
-	github.com/chrispappas/golang-generics-set v1.0.1
 	github.com/gammazero/deque v0.2.1
 	github.com/gin-gonic/gin v1.10.0
 	github.com/glebarez/sqlite v1.10.0
+	github.com/golang/snappy v1.0.0
 	github.com/minor-industries/platform v0.0.3
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.19.0
 	github.com/stretchr/testify v1.9.0
 	github.com/tinylib/msgp v1.1.9
+	google.golang.org/protobuf v1.34.1
 	gorm.io/gorm v1.25.7
 	nhooyr.io/websocket v1.8.10
 )
@@ -56,7 +57,6 @@ require (
 	golang.org/x/net v0.25.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
-	google.golang.org/protobuf v1.34.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	modernc.org/libc v1.22.5 // indirect
 	modernc.org/mathutil v1.5.0 // indirect
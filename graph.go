@@ -4,11 +4,17 @@ import (
 	"fmt"
 	"github.com/minor-industries/rtgraph/broker"
 	"github.com/minor-industries/rtgraph/computed_series"
+	"github.com/minor-industries/rtgraph/lineprotocol"
 	"github.com/minor-industries/rtgraph/messages"
+	"github.com/minor-industries/rtgraph/prom"
 	"github.com/minor-industries/rtgraph/schema"
 	"github.com/minor-industries/rtgraph/storage"
 	"github.com/minor-industries/rtgraph/subscription"
 	"github.com/pkg/errors"
+	"io"
+	"net"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -19,10 +25,19 @@ type Graph struct {
 	broker *broker.Broker
 	db     storage.StorageBackend
 	Parser *computed_series.Parser
+
+	influxNames *lineprotocol.Template
+	remoteWrite *seriesClock
+	units       *unitCache
 }
 
 type Opts struct {
 	ExternalMetrics func(broker *broker.Broker, errCh chan error)
+	Scrape          *prom.Scraper // polls Prometheus endpoints, independent of ExternalMetrics
+	Retention       RetentionPolicy
+	Influx          InfluxOpts
+	Graphite        GraphiteOpts
+	StatsD          StatsDOpts
 }
 
 func New(
@@ -30,6 +45,52 @@ func New(
 	errCh chan error,
 	opts Opts,
 ) (*Graph, error) {
+	if err := opts.Retention.validate(); err != nil {
+		return nil, errors.Wrap(err, "retention policy")
+	}
+
+	influxNames, err := opts.Influx.template()
+	if err != nil {
+		return nil, errors.Wrap(err, "influx name template")
+	}
+
+	var influxUDP net.PacketConn
+	if opts.Influx.UDPAddr != "" {
+		influxUDP, err = net.ListenPacket("udp", opts.Influx.UDPAddr)
+		if err != nil {
+			return nil, errors.Wrap(err, "influx udp listen")
+		}
+	}
+
+	// close what is already listening if a later listener fails
+	var listening []io.Closer
+	fail := func(err error, msg string) (*Graph, error) {
+		for _, l := range listening {
+			l.Close()
+		}
+		return nil, errors.Wrap(err, msg)
+	}
+	if influxUDP != nil {
+		listening = append(listening, influxUDP)
+	}
+
+	var graphiteTCP net.Listener
+	if opts.Graphite.TCPAddr != "" {
+		graphiteTCP, err = net.Listen("tcp", opts.Graphite.TCPAddr)
+		if err != nil {
+			return fail(err, "graphite tcp listen")
+		}
+		listening = append(listening, graphiteTCP)
+	}
+
+	var statsdUDP net.PacketConn
+	if opts.StatsD.UDPAddr != "" {
+		statsdUDP, err = net.ListenPacket("udp", opts.StatsD.UDPAddr)
+		if err != nil {
+			return fail(err, "statsd udp listen")
+		}
+	}
+
 	br := broker.NewBroker()
 
 	g := &Graph{
@@ -37,12 +98,37 @@ func New(
 		db:     backend,
 		errCh:  errCh,
 		Parser: computed_series.NewParser(),
+
+		influxNames: influxNames,
+		remoteWrite: newSeriesClock(),
+		units:       newUnitCache(backend),
 	}
 
+	g.Parser.SetUnitLookup(g.units.unitOf)
+	g.Parser.SetSeriesLookup(func(seriesName string) bool {
+		names, err := backend.AllSeriesNames()
+		return err == nil && slices.Contains(names, seriesName)
+	})
+
 	if opts.ExternalMetrics != nil {
 		go opts.ExternalMetrics(g.broker, errCh)
 	}
+	if opts.Scrape != nil {
+		go opts.Scrape.Run(g.broker, errCh)
+	}
 	go g.publishToDB()
+	if opts.Retention.enabled() {
+		go g.enforceRetention(opts.Retention)
+	}
+	if influxUDP != nil {
+		go g.listenInfluxUDP(influxUDP)
+	}
+	if graphiteTCP != nil {
+		go g.listenGraphite(graphiteTCP)
+	}
+	if statsdUDP != nil {
+		go g.listenStatsD(statsdUDP, opts.StatsD.flushInterval())
+	}
 	go br.Start()
 	//go g.monitorDrops()
 
@@ -67,18 +153,87 @@ func (g *Graph) CreateValue(
 	return nil
 }
 
+// SetSeriesMetadata stores the unit, description and display hints of a series.
+// Subscribers receive it along with the initial data.
+func (g *Graph) SetSeriesMetadata(
+	seriesName string,
+	metadata schema.SeriesMetadata,
+) error {
+	defer g.units.forget(seriesName)
+	return errors.Wrap(g.db.SetMetadata(seriesName, metadata), "set metadata")
+}
+
+// unitCache keeps the stored units the parser asks for on every Parse.
+// Series without a unit are not cached, so lookups of made-up names can't
+// grow it.
+type unitCache struct {
+	lock  sync.Mutex
+	db    storage.StorageBackend
+	units map[string]string
+}
+
+func newUnitCache(db storage.StorageBackend) *unitCache {
+	return &unitCache{db: db, units: map[string]string{}}
+}
+
+func (c *unitCache) unitOf(seriesName string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if unit, ok := c.units[seriesName]; ok {
+		return unit, nil
+	}
+
+	md, err := c.db.LoadMetadata(seriesName)
+	if err != nil {
+		return "", err
+	}
+	if md.Unit != "" {
+		c.units[seriesName] = md.Unit
+	}
+	return md.Unit, nil
+}
+
+func (c *unitCache) forget(seriesName string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.units, seriesName)
+}
+
+func (g *Graph) SeriesMetadata(seriesName string) (schema.SeriesMetadata, error) {
+	md, err := g.db.LoadMetadata(seriesName)
+	return md, errors.Wrap(err, "load metadata")
+}
+
 func (g *Graph) Subscribe(
 	req *subscription.Request,
 	now time.Time,
 	msgCh chan *messages.Data,
+) {
+	g.SubscribeWithControl(req, now, msgCh, nil)
+}
+
+// SubscribeWithControl is Subscribe for clients that change the subscription
+// while it runs. It returns once ctrlCh is closed.
+func (g *Graph) SubscribeWithControl(
+	req *subscription.Request,
+	now time.Time,
+	msgCh chan *messages.Data,
+	ctrlCh <-chan subscription.Control,
 ) {
 	msgCh <- &messages.Data{
 		Now: uint64(now.UnixMilli()),
 	}
 
-	start := req.Start(now)
+	rng, err := req.Range(now)
+	if err != nil {
+		msgCh <- &messages.Data{
+			Error: errors.Wrap(err, "time range").Error(),
+		}
+		return
+	}
 
-	sub, err := subscription.NewSubscription(g.Parser, req, start)
+	sub, err := subscription.NewRangeSubscription(g.Parser, req, rng)
 	if err != nil {
 		msgCh <- &messages.Data{
 			Error: errors.Wrap(err, "new subscription").Error(),
@@ -86,11 +241,11 @@ func (g *Graph) Subscribe(
 		return
 	}
 
-	sub.Run(
+	sub.RunWithControl(
 		g.db,
 		g.broker,
 		msgCh,
-		start,
+		ctrlCh,
 	)
 }
 
@@ -0,0 +1,40 @@
+package rtgraph
+
+import (
+	"github.com/minor-industries/rtgraph/database/inmem"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type countingBackend struct {
+	*inmem.Backend
+	loads int
+}
+
+func (b *countingBackend) LoadMetadata(seriesName string) (schema.SeriesMetadata, error) {
+	b.loads++
+	return b.Backend.LoadMetadata(seriesName)
+}
+
+func TestUnitCache(t *testing.T) {
+	db := &countingBackend{Backend: inmem.NewBackend()}
+	g, err := New(db, make(chan error, 1), Opts{})
+	require.NoError(t, err)
+
+	require.NoError(t, g.SetSeriesMetadata("temp", schema.SeriesMetadata{Unit: "C"}))
+
+	for i := 0; i < 3; i++ {
+		_, err := g.Parser.ParseNode("temp | convert F", time.Time{})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, db.loads)
+
+	// a new unit is picked up by the next parse
+	require.NoError(t, g.SetSeriesMetadata("temp", schema.SeriesMetadata{Unit: "K"}))
+	node, err := g.Parser.ParseNode("temp | convert C", time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 2, db.loads)
+	require.InDelta(t, 0, node.Process("temp", []schema.Value{{Value: 273.15}})[0].Value, 1e-9)
+}
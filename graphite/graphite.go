@@ -0,0 +1,41 @@
+// Package graphite parses the Graphite plaintext protocol: "path value timestamp"
+package graphite
+
+import (
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Metric struct {
+	Path  string
+	Value float64
+	Time  time.Time // zero when the timestamp is missing or -1
+}
+
+// ParseLine parses one line. The timestamp is in seconds and may have a fraction.
+func ParseLine(line string) (Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Metric{}, errors.Errorf("expected \"path value timestamp\", got %q", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Metric{}, errors.Errorf("invalid value %q", fields[1])
+	}
+
+	m := Metric{Path: fields[0], Value: value}
+
+	if len(fields) == 3 && fields[2] != "-1" {
+		secs, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || secs < 0 || secs > math.MaxInt64/float64(time.Second) {
+			return Metric{}, errors.Errorf("invalid timestamp %q", fields[2])
+		}
+		m.Time = time.Unix(0, int64(secs*float64(time.Second)))
+	}
+
+	return m, nil
+}
@@ -0,0 +1,28 @@
+package graphite
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	m, err := ParseLine("servers.web1.load 0.75 1700000000")
+	require.NoError(t, err)
+	require.Equal(t, Metric{Path: "servers.web1.load", Value: 0.75, Time: time.Unix(1700000000, 0)}, m)
+
+	m, err = ParseLine("  disk.used\t42  1700000000.5 ")
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1700000000, 500_000_000), m.Time)
+
+	for _, line := range []string{"load 1", "load 1 -1"} {
+		m, err = ParseLine(line)
+		require.NoError(t, err)
+		require.True(t, m.Time.IsZero())
+	}
+
+	for _, line := range []string{"", "load", "load x 1", "load 1 x", "load 1 2 3", "load NaN 1", "load 1 -5"} {
+		_, err := ParseLine(line)
+		require.Error(t, err, line)
+	}
+}
@@ -0,0 +1,164 @@
+package rtgraph
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/minor-industries/rtgraph/lineprotocol"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxLineErrors limits how many failed lines are described in a response
+const maxLineErrors = 10
+
+// InfluxOpts configures InfluxDB line protocol ingestion. The HTTP write
+// endpoints are always served; the UDP listener only when UDPAddr is set.
+type InfluxOpts struct {
+	// NameTemplate maps points to series names, see lineprotocol.Template.
+	// Defaults to lineprotocol.DefaultTemplate.
+	NameTemplate string
+
+	UDPAddr string // e.g. ":8089"
+}
+
+func (o InfluxOpts) template() (*lineprotocol.Template, error) {
+	if o.NameTemplate == "" {
+		return lineprotocol.NewTemplate(lineprotocol.DefaultTemplate)
+	}
+	return lineprotocol.NewTemplate(o.NameTemplate)
+}
+
+// influxBatch maps every numeric field of the points to a series. Points
+// without a timestamp get now. Fields whose name is not a valid series name
+// are skipped and reported as line errors.
+func (g *Graph) influxBatch(points []lineprotocol.Point, now time.Time) (map[string][]schema.Value, []lineprotocol.LineError) {
+	batch := map[string][]schema.Value{}
+	var lineErrors []lineprotocol.LineError
+	for _, p := range points {
+		ts := p.Time
+		if ts.IsZero() {
+			ts = now
+		}
+		for _, f := range p.Fields {
+			name := g.influxNames.Name(p, f.Key)
+			if err := validSeriesName(name); err != nil {
+				lineErrors = append(lineErrors, lineprotocol.LineError{Line: p.Line, Err: errors.Wrapf(err, "field %s", f.Key)})
+				continue
+			}
+			batch[name] = append(batch[name], schema.Value{Timestamp: ts, Value: f.Value})
+		}
+	}
+	return batch, lineErrors
+}
+
+func describeLineErrors(lineErrors []lineprotocol.LineError) string {
+	var msgs []string
+	for _, e := range lineErrors[:min(len(lineErrors), maxLineErrors)] {
+		msgs = append(msgs, e.Error())
+	}
+	if len(lineErrors) > maxLineErrors {
+		msgs = append(msgs, fmt.Sprintf("and %d more", len(lineErrors)-maxLineErrors))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// handleInfluxWrite serves the v1 /write and v2 /api/v2/write endpoints. Like
+// InfluxDB, valid lines are written even when others fail, and the failures
+// are returned with a 400.
+func (g *Graph) handleInfluxWrite(v2 bool) gin.HandlerFunc {
+	fail := func(c *gin.Context, status int, msg string) {
+		if v2 {
+			c.JSON(status, gin.H{"code": "invalid", "message": msg})
+		} else {
+			c.JSON(status, gin.H{"error": msg})
+		}
+	}
+
+	return func(c *gin.Context) {
+		precision, err := lineprotocol.ParsePrecision(c.Query("precision"))
+		if err != nil {
+			fail(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		body, err := readInfluxBody(c)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		points, lineErrors := lineprotocol.Parse(body, precision)
+		batch, nameErrors := g.influxBatch(points, time.Now())
+		if err := g.publishBatch(batch); err != nil {
+			fail(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		lineErrors = append(lineErrors, nameErrors...)
+		sort.SliceStable(lineErrors, func(i, j int) bool {
+			return lineErrors[i].Line < lineErrors[j].Line
+		})
+
+		if len(lineErrors) > 0 {
+			fail(c, http.StatusBadRequest, describeLineErrors(lineErrors))
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// readInfluxBody reads the request body, which Telegraf gzips by default
+func readInfluxBody(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxWriteBody)
+
+	var r io.Reader = c.Request.Body
+	if c.GetHeader("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "gzip")
+		}
+		defer gz.Close()
+		r = io.LimitReader(gz, maxWriteBody+1)
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read body")
+	}
+	if len(body) > maxWriteBody {
+		return nil, errors.New("body too large")
+	}
+	return body, nil
+}
+
+func (g *Graph) listenInfluxUDP(conn net.PacketConn) {
+	defer conn.Close()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			g.errCh <- errors.Wrap(err, "influx udp read")
+			return
+		}
+
+		points, lineErrors := lineprotocol.Parse(buf[:n], time.Nanosecond)
+		batch, nameErrors := g.influxBatch(points, time.Now())
+		lineErrors = append(lineErrors, nameErrors...)
+		if len(lineErrors) > 0 {
+			fmt.Println("influx udp parse error", describeLineErrors(lineErrors))
+		}
+		if err := g.publishBatch(batch); err != nil {
+			g.errCh <- errors.Wrap(err, "influx udp publish")
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package rtgraph
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/minor-industries/rtgraph/database/inmem"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitForValues(t *testing.T, db *inmem.Backend, series string, n int) {
+	require.Eventually(t, func() bool {
+		s, err := db.LoadDataAfter(series, time.UnixMilli(0))
+		require.NoError(t, err)
+		return len(s.Values) == n
+	}, 2*time.Second, 10*time.Millisecond, series)
+}
+
+func TestInfluxWrite(t *testing.T) {
+	_, db, r := newTestServer(t)
+
+	body := "cpu,host=a idle=90,user=5i 1700000000\ncpu,host=a idle=80 1700000010\nbroken\n"
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err := zw.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	// repeat until the db writer has subscribed, duplicate points are ignored
+	require.Eventually(t, func() bool {
+		req := httptest.NewRequest(http.MethodPost, "/rtgraph/api/v2/write?org=x&bucket=y&precision=s", bytes.NewReader(gz.Bytes()))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), "line 3")
+
+		s, err := db.LoadDataAfter("cpu.idle", time.UnixMilli(0))
+		require.NoError(t, err)
+		return len(s.Values) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	s, err := db.LoadDataAfter("cpu.idle", time.UnixMilli(0))
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1700000000, 0), s.Values[0].Timestamp)
+	waitForValues(t, db, "cpu.user", 1)
+
+	w := post(r, "/rtgraph/write?precision=ms", "mem used=1 1700000000000")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	waitForValues(t, db, "mem.used", 1)
+
+	// names from the template are validated like any other series name
+	long := strings.Repeat("m", maxSeriesNameLen)
+	w = post(r, "/rtgraph/write?precision=s", "disk free=1 1700000000\n"+long+" used=1 1700000000")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "line 2: field used: series name longer than")
+	waitForValues(t, db, "disk.free", 1)
+
+	w = post(r, "/rtgraph/write?precision=fortnight", "mem used=1")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), `"error"`)
+}
+
+func TestInfluxUDP(t *testing.T) {
+	db := inmem.NewBackend()
+	g, err := New(db, make(chan error, 1), Opts{
+		Influx: InfluxOpts{NameTemplate: "{tag:room}_{field}"},
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go g.listenInfluxUDP(conn)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.Eventually(t, func() bool {
+		_, err := client.Write([]byte("env,room=kitchen temp=21.5 1700000000000000000\n"))
+		require.NoError(t, err)
+
+		s, err := db.LoadDataAfter("kitchen_temp", time.UnixMilli(0))
+		require.NoError(t, err)
+		return len(s.Values) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	_, err = New(db, make(chan error, 1), Opts{Influx: InfluxOpts{NameTemplate: "{measurement}"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package rtgraph
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/minor-industries/rtgraph/subscription"
+	"github.com/pkg/errors"
+	"net/http"
+	"sort"
+	"time"
+	"unicode"
+)
+
+const (
+	maxWriteBody      = 10 << 20
+	maxSeriesNameLen  = 256
+	maxWriteFutureAge = 24 * time.Hour // reject timestamps this far ahead, usually a unit mixup
+)
+
+// WritePoint is one sample in a write request. Timestamp is milliseconds since
+// the epoch or any other form TimeSpec accepts, and defaults to now.
+type WritePoint struct {
+	Series    string                `json:"series"`
+	Timestamp subscription.TimeSpec `json:"timestamp"`
+	Value     *float64              `json:"value"`
+}
+
+type PointError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type WriteResponse struct {
+	Accepted int          `json:"accepted"`
+	Errors   []PointError `json:"errors,omitempty"`
+}
+
+// CreateValues publishes several values of one series at once
+func (g *Graph) CreateValues(seriesName string, values []schema.Value) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	g.broker.Publish(schema.Series{
+		SeriesName: seriesName,
+		Values:     values,
+	})
+
+	return nil
+}
+
+// publishBatch publishes values grouped by series, each in timestamp order
+func (g *Graph) publishBatch(batch map[string][]schema.Value) error {
+	for name, values := range batch {
+		sort.SliceStable(values, func(i, j int) bool {
+			return values[i].Timestamp.Before(values[j].Timestamp)
+		})
+		if err := g.CreateValues(name, values); err != nil {
+			return errors.Wrapf(err, "create values for %s", name)
+		}
+	}
+	return nil
+}
+
+func validSeriesName(name string) error {
+	if name == "" {
+		return errors.New("series is required")
+	}
+	if len(name) > maxSeriesNameLen {
+		return errors.Errorf("series name longer than %d bytes", maxSeriesNameLen)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return errors.New("series name contains control characters")
+		}
+	}
+	return nil
+}
+
+func (p WritePoint) value(now time.Time) (schema.Value, error) {
+	if err := validSeriesName(p.Series); err != nil {
+		return schema.Value{}, err
+	}
+
+	if p.Value == nil {
+		return schema.Value{}, errors.New("value is required")
+	}
+
+	ts := now
+	if p.Timestamp != "" {
+		var err error
+		ts, err = p.Timestamp.Resolve(now, time.UTC)
+		if err != nil {
+			return schema.Value{}, errors.Wrap(err, "timestamp")
+		}
+		if ts.After(now.Add(maxWriteFutureAge)) {
+			return schema.Value{}, errors.Errorf("timestamp %s is in the future, expected milliseconds", p.Timestamp)
+		}
+	}
+
+	return schema.Value{Timestamp: ts, Value: *p.Value}, nil
+}
+
+// decodeWrite parses a JSON array of points. Points that fail to decode or
+// validate are reported by index without rejecting the rest.
+func decodeWrite(body []byte, now time.Time) (map[string][]schema.Value, []PointError, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, nil, errors.Wrap(err, "expected a JSON array of points")
+	}
+
+	batch := map[string][]schema.Value{}
+	var pointErrors []PointError
+
+	for idx, msg := range raw {
+		var p WritePoint
+		v, err := func() (schema.Value, error) {
+			if err := json.Unmarshal(msg, &p); err != nil {
+				return schema.Value{}, err
+			}
+			return p.value(now)
+		}()
+		if err != nil {
+			pointErrors = append(pointErrors, PointError{Index: idx, Error: err.Error()})
+			continue
+		}
+		batch[p.Series] = append(batch[p.Series], v)
+	}
+
+	return batch, pointErrors, nil
+}
+
+// handleWrite accepts a JSON array of {series, timestamp, value}. Valid points
+// are published even when others are rejected, the response lists the
+// rejected ones and is a 400 if there are any.
+func (g *Graph) handleWrite(c *gin.Context) {
+	body, err := readBody(c, maxWriteBody)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	batch, pointErrors, err := decodeWrite(body, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := g.publishBatch(batch); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := WriteResponse{Errors: pointErrors}
+	for _, values := range batch {
+		resp.Accepted += len(values)
+	}
+
+	status := http.StatusOK
+	if len(pointErrors) > 0 {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, resp)
+}
+
+func readBody(c *gin.Context, limit int64) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, errors.Wrap(err, "read body")
+	}
+	return body, nil
+}
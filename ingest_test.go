@@ -0,0 +1,79 @@
+package rtgraph
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/minor-industries/rtgraph/database/inmem"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (*Graph, *inmem.Backend, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+
+	db := inmem.NewBackend()
+	g, err := New(db, make(chan error, 1), Opts{})
+	require.NoError(t, err)
+
+	r := gin.New()
+	g.SetupServer(r.Group("/rtgraph"))
+	return g, db, r
+}
+
+func post(r http.Handler, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	return w
+}
+
+func TestWriteEndpoint(t *testing.T) {
+	_, db, r := newTestServer(t)
+
+	body := `[
+		{"series": "temp", "timestamp": 2000, "value": 21.5},
+		{"series": "temp", "timestamp": 1000, "value": 21},
+		{"series": "hum", "timestamp": "1970-01-01T00:00:01Z", "value": 40},
+		{"series": "hum", "timestamp": 3000.7, "value": 41},
+		{"series": "", "value": 1},
+		{"series": "temp", "timestamp": 1000},
+		{"series": "temp", "value": "hot"},
+		{"series": "temp", "timestamp": "yesterday-ish", "value": 1}
+	]`
+
+	// writes are idempotent, repeat until the db writer has subscribed
+	var resp WriteResponse
+	require.Eventually(t, func() bool {
+		w := post(r, "/rtgraph/api/write", body)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		temp, err := db.LoadDataAfter("temp", time.UnixMilli(0))
+		require.NoError(t, err)
+		return len(temp.Values) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, 4, resp.Accepted)
+	var indexes []int
+	for _, e := range resp.Errors {
+		indexes = append(indexes, e.Index)
+	}
+	require.Equal(t, []int{4, 5, 6, 7}, indexes)
+
+	hum, err := db.LoadDataAfter("hum", time.UnixMilli(0))
+	require.NoError(t, err)
+	require.Len(t, hum.Values, 2)
+	require.Equal(t, 40.0, hum.Values[0].Value)
+	require.Equal(t, time.UnixMilli(3000), hum.Values[1].Timestamp)
+
+	w := post(r, "/rtgraph/api/write", `[{"series": "temp", "value": 1}]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"accepted": 1}`, w.Body.String())
+
+	w = post(r, "/rtgraph/api/write", `{"series": "temp"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "expected a JSON array")
+}
@@ -0,0 +1,252 @@
+// Package lineprotocol parses InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+// Only numeric and boolean fields are kept, string fields are skipped.
+package lineprotocol
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Tag struct {
+	Key   string
+	Value string
+}
+
+type Field struct {
+	Key   string
+	Value float64
+}
+
+type Point struct {
+	Measurement string
+	Tags        []Tag // sorted by key
+	Fields      []Field
+	Time        time.Time // zero when the line has no timestamp
+	Line        int       // set by Parse, counting from 1
+}
+
+// LineError is a line that could not be parsed, counting lines from 1
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// ParsePrecision accepts the precision names of both the v1 and v2 write APIs
+func ParsePrecision(s string) (time.Duration, error) {
+	switch s {
+	case "", "ns", "n":
+		return time.Nanosecond, nil
+	case "us", "u":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	return 0, errors.Errorf("unknown precision %q", s)
+}
+
+// Parse parses every line of data. Lines that fail are reported without
+// affecting the others.
+func Parse(data []byte, precision time.Duration) ([]Point, []LineError) {
+	var points []Point
+	var lineErrors []LineError
+
+	for idx, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := ParseLine(line, precision)
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: idx + 1, Err: err})
+			continue
+		}
+		p.Line = idx + 1
+		points = append(points, p)
+	}
+
+	return points, lineErrors
+}
+
+func ParseLine(line string, precision time.Duration) (Point, error) {
+	key, rest := cut(line, ' ', false)
+	fields, ts := cut(rest, ' ', true)
+	ts = strings.TrimSpace(ts)
+
+	if fields == "" {
+		return Point{}, errors.New("missing fields")
+	}
+
+	var p Point
+
+	parts := split(key, ',', false)
+	p.Measurement = unescape(parts[0])
+	if p.Measurement == "" {
+		return Point{}, errors.New("missing measurement")
+	}
+
+	for _, part := range parts[1:] {
+		k, v := cut(part, '=', false)
+		if k == "" || v == "" {
+			return Point{}, errors.Errorf("invalid tag %q", part)
+		}
+		p.Tags = append(p.Tags, Tag{Key: unescape(k), Value: unescape(v)})
+	}
+	sort.Slice(p.Tags, func(i, j int) bool {
+		return p.Tags[i].Key < p.Tags[j].Key
+	})
+
+	for _, part := range split(fields, ',', true) {
+		k, v := cut(part, '=', true)
+		if k == "" || v == "" {
+			return Point{}, errors.Errorf("invalid field %q", part)
+		}
+
+		value, numeric, err := parseFieldValue(v)
+		if err != nil {
+			return Point{}, errors.Wrapf(err, "field %s", unescape(k))
+		}
+		if numeric {
+			p.Fields = append(p.Fields, Field{Key: unescape(k), Value: value})
+		}
+	}
+
+	if ts != "" {
+		n, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return Point{}, errors.Errorf("invalid timestamp %q", ts)
+		}
+		p.Time, err = timestamp(n, precision)
+		if err != nil {
+			return Point{}, err
+		}
+	}
+
+	return p, nil
+}
+
+func timestamp(n int64, precision time.Duration) (time.Time, error) {
+	// count whole seconds for coarse precisions so that they don't overflow nanoseconds
+	unit, toTime := int64(precision), func(x int64) time.Time { return time.Unix(0, x) }
+	if precision >= time.Second {
+		unit, toTime = int64(precision/time.Second), func(x int64) time.Time { return time.Unix(x, 0) }
+	}
+
+	x := n * unit
+	if n != 0 && x/n != unit {
+		return time.Time{}, errors.Errorf("timestamp %d out of range", n)
+	}
+	return toTime(x), nil
+}
+
+// parseFieldValue reports whether v is numeric; strings are valid but not numeric
+func parseFieldValue(v string) (float64, bool, error) {
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	if v[0] == '"' {
+		if !quoted(v) {
+			return 0, false, errors.New("unterminated string")
+		}
+		return 0, false, nil
+	}
+
+	switch v[len(v)-1] {
+	case 'i':
+		n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return 0, false, errors.Errorf("invalid integer %q", v)
+		}
+		return float64(n), true, nil
+	case 'u':
+		n, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return 0, false, errors.Errorf("invalid unsigned integer %q", v)
+		}
+		return float64(n), true, nil
+	}
+
+	x, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(x) || math.IsInf(x, 0) {
+		return 0, false, errors.Errorf("invalid number %q", v)
+	}
+	return x, true, nil
+}
+
+// quoted reports whether v is a single string, closed by its last character
+func quoted(v string) bool {
+	for i := 1; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			i++
+		case '"':
+			return i == len(v)-1
+		}
+	}
+	return false
+}
+
+// cut splits s at the first sep that is not escaped, or quoted when quotes is set
+func cut(s string, sep byte, quotes bool) (string, string) {
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case quotes && c == '"':
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+func split(s string, sep byte, quotes bool) []string {
+	var result []string
+	for {
+		part, rest := cut(s, sep, quotes)
+		result = append(result, part)
+		if len(part) == len(s) {
+			return result
+		}
+		s = rest
+	}
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`, ="\`, s[i+1]) >= 0 {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
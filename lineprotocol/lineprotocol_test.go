@@ -0,0 +1,109 @@
+package lineprotocol
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	data := `# comment
+cpu,host=a,region=us\ west usage_idle=92.5,usage_user=3i,online=t 1700000000000000000
+weather temp=21.5,station="back yard, north",count=7u
+
+my\,meas,tag\=key=va\ lue value=1 1700000000
+bad line
+cpu usage=abc
+cpu usage=NaN
+cpu s="unterminated
+cpu usage=1 notatime
+,host=a usage=1
+cpu,host usage=1
+`
+
+	points, lineErrors := Parse([]byte(data), time.Nanosecond)
+
+	require.Len(t, points, 3)
+
+	require.Equal(t, Point{
+		Measurement: "cpu",
+		Tags:        []Tag{{"host", "a"}, {"region", "us west"}},
+		Fields:      []Field{{"usage_idle", 92.5}, {"usage_user", 3}, {"online", 1}},
+		Time:        time.Unix(1700000000, 0),
+		Line:        2,
+	}, points[0])
+
+	require.Equal(t, "weather", points[1].Measurement)
+	require.Equal(t, []Field{{"temp", 21.5}, {"count", 7}}, points[1].Fields)
+	require.True(t, points[1].Time.IsZero())
+
+	require.Equal(t, "my,meas", points[2].Measurement)
+	require.Equal(t, []Tag{{"tag=key", "va lue"}}, points[2].Tags)
+	require.Equal(t, time.Unix(0, 1700000000), points[2].Time)
+
+	var lines []int
+	for _, e := range lineErrors {
+		lines = append(lines, e.Line)
+	}
+	require.Equal(t, []int{6, 7, 8, 9, 10, 11, 12}, lines)
+}
+
+func TestPrecision(t *testing.T) {
+	for precision, want := range map[string]time.Time{
+		"":   time.Unix(0, 1700000000),
+		"ms": time.UnixMilli(1700000000),
+		"s":  time.Unix(1700000000, 0),
+	} {
+		d, err := ParsePrecision(precision)
+		require.NoError(t, err)
+		p, err := ParseLine("m v=1 1700000000", d)
+		require.NoError(t, err)
+		require.Equal(t, want, p.Time, precision)
+	}
+
+	p, err := ParseLine("m v=1 472222", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(472222*3600, 0), p.Time)
+
+	_, err = ParseLine("m v=1 9000000000000000000", time.Hour)
+	require.Error(t, err)
+
+	_, err = ParsePrecision("fortnight")
+	require.Error(t, err)
+}
+
+func TestTemplate(t *testing.T) {
+	p := Point{
+		Measurement: "cpu",
+		Tags:        []Tag{{"cpu", "0"}, {"host", "a b/c"}},
+	}
+
+	for template, want := range map[string]string{
+		DefaultTemplate:                    "cpu.idle",
+		"{measurement}.{tag:host}.{field}": "cpu.a b/c.idle",
+		"{tag:missing}{field}":             "idle",
+		"{measurement}.{tags}.{field}":     "cpu.cpu.0.host.a_b_c.idle",
+	} {
+		tmpl, err := NewTemplate(template)
+		require.NoError(t, err)
+		require.Equal(t, want, tmpl.Name(p, "idle"), template)
+	}
+
+	// an empty {tags} takes one separator with it
+	for template, want := range map[string]string{
+		"{measurement}.{tags}.{field}": "cpu.idle",
+		"{tags}.{measurement}.{field}": "cpu.idle",
+		"{measurement}.{field}.{tags}": "cpu.idle",
+		"{measurement}{tags}.{field}":  "cpu.idle",
+		"{tags}.{tags}.{field}":        "idle",
+	} {
+		tmpl, err := NewTemplate(template)
+		require.NoError(t, err)
+		require.Equal(t, want, tmpl.Name(Point{Measurement: "cpu"}, "idle"), template)
+	}
+
+	for _, template := range []string{"{measurement}", "{field", "{host}.{field}", "{tag:}{field}"} {
+		_, err := NewTemplate(template)
+		require.Error(t, err, template)
+	}
+}
@@ -0,0 +1,134 @@
+package lineprotocol
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// DefaultTemplate names series like cpu.usage_idle
+const DefaultTemplate = "{measurement}.{field}"
+
+// Template builds series names from points. Placeholders are {measurement},
+// {field}, {tag:key} for the value of one tag (empty when missing) and {tags}
+// for all tags as key.value joined by dots, e.g.
+//
+//	{measurement}.{tag:host}.{field}
+//	{measurement}.{tags}.{field}
+//
+// Like prom.SeriesName, {tags} replaces characters that cannot appear in a
+// bare series name with "_", so names such as cpu.host.a.usage_idle need no
+// quotes in expressions. Other placeholders are inserted as they are.
+type Template struct {
+	segments []segment
+}
+
+type segment struct {
+	literal string
+	kind    string // measurement, field, tag or tags, empty for literals
+	tag     string
+}
+
+func NewTemplate(s string) (*Template, error) {
+	t := &Template{}
+	hasField := false
+
+	for s != "" {
+		open := strings.IndexByte(s, '{')
+		if open < 0 {
+			t.segments = append(t.segments, segment{literal: s})
+			break
+		}
+		if open > 0 {
+			t.segments = append(t.segments, segment{literal: s[:open]})
+		}
+
+		end := strings.IndexByte(s[open:], '}')
+		if end < 0 {
+			return nil, errors.Errorf("unclosed placeholder in %q", s)
+		}
+		name := s[open+1 : open+end]
+		s = s[open+end+1:]
+
+		switch {
+		case name == "measurement" || name == "tags":
+			t.segments = append(t.segments, segment{kind: name})
+		case name == "field":
+			hasField = true
+			t.segments = append(t.segments, segment{kind: name})
+		case strings.HasPrefix(name, "tag:") && len(name) > len("tag:"):
+			t.segments = append(t.segments, segment{kind: "tag", tag: name[len("tag:"):]})
+		default:
+			return nil, errors.Errorf("unknown placeholder {%s}", name)
+		}
+	}
+
+	if !hasField {
+		// fields of one point would all get the same name
+		return nil, errors.New("template must contain {field}")
+	}
+
+	return t, nil
+}
+
+// Name returns the series name of field of p. When {tags} expands to nothing,
+// a separator next to it is dropped too, so cpu.{tags}.usage_idle gives
+// cpu.usage_idle for a point without tags.
+func (t *Template) Name(p Point, field string) string {
+	var b []byte
+	afterLiteral := false // b ends with a literal segment
+	skipSep := false      // the name starts with an empty {tags}
+
+	for _, seg := range t.segments {
+		if seg.kind == "tags" && len(p.Tags) == 0 {
+			if afterLiteral && len(b) > 0 && isSeparator(b[len(b)-1]) {
+				b = b[:len(b)-1]
+			} else if len(b) == 0 {
+				skipSep = true
+			}
+			continue
+		}
+
+		lit := seg.kind == ""
+		switch seg.kind {
+		case "":
+			s := seg.literal
+			if skipSep && isSeparator(s[0]) {
+				s = s[1:]
+			}
+			b = append(b, s...)
+		case "measurement":
+			b = append(b, p.Measurement...)
+		case "field":
+			b = append(b, field...)
+		case "tag":
+			for _, tag := range p.Tags {
+				if tag.Key == seg.tag {
+					b = append(b, tag.Value...)
+					break
+				}
+			}
+		case "tags":
+			for i, tag := range p.Tags {
+				if i > 0 {
+					b = append(b, '.')
+				}
+				b = append(b, sanitize(tag.Key)+"."+sanitize(tag.Value)...)
+			}
+		}
+		afterLiteral, skipSep = lit, false
+	}
+	return string(b)
+}
+
+func isSeparator(c byte) bool {
+	return !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9')
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || strings.ContainsRune("_.:-", r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
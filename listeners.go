@@ -0,0 +1,138 @@
+package rtgraph
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/minor-industries/rtgraph/graphite"
+	"github.com/minor-industries/rtgraph/statsd"
+	"github.com/pkg/errors"
+	"net"
+	"time"
+)
+
+// GraphiteOpts enables the Graphite plaintext listener when TCPAddr is set.
+// The metric path is used as the series name.
+type GraphiteOpts struct {
+	TCPAddr string // e.g. ":2003"
+}
+
+// StatsDOpts enables the StatsD listener when UDPAddr is set, see package
+// statsd for the series produced on every flush
+type StatsDOpts struct {
+	UDPAddr       string        // e.g. ":8125"
+	FlushInterval time.Duration // defaults to 10s
+}
+
+func (o StatsDOpts) flushInterval() time.Duration {
+	if o.FlushInterval <= 0 {
+		return 10 * time.Second
+	}
+	return o.FlushInterval
+}
+
+func (g *Graph) listenGraphite(ln net.Listener) {
+	defer ln.Close()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			g.errCh <- errors.Wrap(err, "graphite accept")
+			return
+		}
+		go g.serveGraphite(conn)
+	}
+}
+
+// serveGraphite reads metrics from one connection until the client closes it
+func (g *Graph) serveGraphite(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		m, err := graphite.ParseLine(scanner.Text())
+		if err == nil {
+			err = validSeriesName(m.Path)
+		}
+		if err != nil {
+			fmt.Println("graphite parse error", err)
+			continue
+		}
+
+		ts := m.Time
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		if err := g.CreateValue(m.Path, ts, m.Value); err != nil {
+			fmt.Println("graphite create value", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Println("graphite read error", err)
+	}
+}
+
+func (g *Graph) listenStatsD(conn net.PacketConn, flushInterval time.Duration) {
+	defer conn.Close()
+
+	agg := statsd.NewAggregator(time.Now())
+	done := make(chan struct{})
+	defer close(done)
+	go g.flushStatsD(agg, flushInterval, done)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			g.errCh <- errors.Wrap(err, "statsd udp read")
+			return
+		}
+
+		metrics, errs := statsd.Parse(string(buf[:n]))
+		for _, err := range errs {
+			fmt.Println("statsd parse error", err)
+		}
+		agg.Add(validStatsD(metrics))
+	}
+}
+
+// validStatsD drops metrics that would be flushed to invalid series names
+func validStatsD(metrics []statsd.Metric) []statsd.Metric {
+	result := metrics[:0]
+	for _, m := range metrics {
+		valid := true
+		for _, name := range m.SeriesNames() {
+			if err := validSeriesName(name); err != nil {
+				fmt.Println("statsd invalid metric", errors.Wrapf(err, "metric %q", m.Name))
+				valid = false
+				break
+			}
+		}
+		if valid {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func (g *Graph) flushStatsD(agg *statsd.Aggregator, interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			for _, s := range agg.Flush(now) {
+				if err := g.CreateValues(s.SeriesName, s.Values); err != nil {
+					fmt.Println("statsd create values", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package rtgraph
+
+import (
+	"github.com/minor-industries/rtgraph/database/inmem"
+	"github.com/minor-industries/rtgraph/statsd"
+	"github.com/stretchr/testify/require"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphiteTCP(t *testing.T) {
+	db := inmem.NewBackend()
+	g, err := New(db, make(chan error, 1), Opts{})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go g.listenGraphite(ln)
+
+	// repeat until the db writer has subscribed, duplicate points are ignored
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("servers.web1.load 0.75 1700000000\nnot a metric line\nservers.web1.load 0.5 1700000010\n"))
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+
+		s, err := db.LoadDataAfter("servers.web1.load", time.UnixMilli(0))
+		require.NoError(t, err)
+		return len(s.Values) == 2
+	}, 2*time.Second, 20*time.Millisecond)
+
+	s, err := db.LoadDataAfter("servers.web1.load", time.UnixMilli(0))
+	require.NoError(t, err)
+	require.True(t, time.Unix(1700000010, 0).Equal(s.Values[1].Timestamp))
+	require.Equal(t, 0.5, s.Values[1].Value)
+}
+
+func TestStatsDUDP(t *testing.T) {
+	db := inmem.NewBackend()
+	g, err := New(db, make(chan error, 1), Opts{})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go g.listenStatsD(conn, 20*time.Millisecond)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.Eventually(t, func() bool {
+		_, err := client.Write([]byte("requests:1|c\ntemperature:21.5|g"))
+		require.NoError(t, err)
+
+		s, err := db.LoadDataAfter("gauges.temperature", time.UnixMilli(0))
+		require.NoError(t, err)
+		return len(s.Values) > 0 && s.Values[0].Value == 21.5
+	}, 2*time.Second, 10*time.Millisecond)
+
+	waitForAny := func(series string) {
+		require.Eventually(t, func() bool {
+			s, err := db.LoadDataAfter(series, time.UnixMilli(0))
+			require.NoError(t, err)
+			return len(s.Values) > 0
+		}, 2*time.Second, 10*time.Millisecond, series)
+	}
+	waitForAny("counters.requests.count")
+	waitForAny("counters.requests.rate")
+}
+
+func TestValidStatsD(t *testing.T) {
+	metrics, errs := statsd.Parse("ok:1|c\n" + strings.Repeat("x", maxSeriesNameLen-len("gauges.")) + ":1|g\nbell\a:1|ms")
+	require.Empty(t, errs)
+	require.Len(t, metrics, 3)
+
+	// the gauge name fits, the timer has a control character
+	valid := validStatsD(metrics)
+	require.Len(t, valid, 2)
+	require.Equal(t, "ok", valid[0].Name)
+
+	long, _ := statsd.Parse(strings.Repeat("x", maxSeriesNameLen-len("counters.")) + ":1|c")
+	require.Empty(t, validStatsD(long))
+}
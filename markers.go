@@ -0,0 +1,51 @@
+package rtgraph
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/pkg/errors"
+	"time"
+)
+
+func newMarkerID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id[:]), nil
+}
+
+// CreateMarker annotates a point in time. The marker is stored and delivered to
+// subscribers that asked for markers of its type.
+func (g *Graph) CreateMarker(
+	markerType string,
+	ref string,
+	timestamp time.Time,
+) (schema.Marker, error) {
+	if markerType == "" {
+		return schema.Marker{}, errors.New("marker type is required")
+	}
+
+	id, err := newMarkerID()
+	if err != nil {
+		return schema.Marker{}, errors.Wrap(err, "new marker id")
+	}
+
+	marker := schema.Marker{
+		ID:        id,
+		Type:      markerType,
+		Ref:       ref,
+		Timestamp: timestamp,
+	}
+
+	g.broker.Publish(marker)
+
+	return marker, nil
+}
+
+// Markers returns the stored markers between start and end
+func (g *Graph) Markers(start, end time.Time) ([]schema.Marker, error) {
+	markers, err := g.db.LoadMarkersBetween(start, end)
+	return markers, errors.Wrap(err, "load markers")
+}
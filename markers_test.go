@@ -0,0 +1,59 @@
+package rtgraph
+
+import (
+	"github.com/minor-industries/rtgraph/messages"
+	"github.com/minor-industries/rtgraph/subscription"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMarkerDelivery(t *testing.T) {
+	g, _, _ := newTestServer(t)
+
+	subscribe := func(markerTypes ...string) chan *messages.Data {
+		msgCh := make(chan *messages.Data, 10)
+		go g.Subscribe(&subscription.Request{
+			Series:      []string{"a"},
+			WindowSize:  60_000,
+			MarkerTypes: markerTypes,
+		}, time.Now(), msgCh)
+		<-msgCh // now
+		initial := <-msgCh
+		require.Empty(t, initial.Error)
+		return msgCh
+	}
+
+	laps := subscribe("lap")
+	pits := subscribe("pit")
+	none := subscribe()
+
+	// the db writer and the three subscriptions
+	require.Eventually(t, func() bool { return g.broker.SubCount() == 4 }, 2*time.Second, time.Millisecond)
+
+	pit, err := g.CreateMarker("pit", "car 7", time.Now())
+	require.NoError(t, err)
+	lap, err := g.CreateMarker("lap", "car 7", time.Now())
+	require.NoError(t, err)
+
+	// pit was published first, so each subscriber getting its own type first
+	// means the other was filtered out
+	next := func(msgCh chan *messages.Data) messages.Marker {
+		select {
+		case data := <-msgCh:
+			require.Len(t, data.Markers, 1)
+			return data.Markers[0]
+		case <-time.After(2 * time.Second):
+			t.Fatal("no marker")
+			return messages.Marker{}
+		}
+	}
+	require.Equal(t, lap.ID, next(laps).ID)
+	require.Equal(t, pit.ID, next(pits).ID)
+
+	// and nothing else arrives
+	time.Sleep(20 * time.Millisecond)
+	require.Empty(t, laps)
+	require.Empty(t, pits)
+	require.Empty(t, none)
+}
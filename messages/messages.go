@@ -8,8 +8,30 @@ type Series struct {
 	Values     []float64
 }
 
+// Metadata describes the series at Pos. The bundled frontend does not use it
+// yet, clients that want units or axis ranges read it from the message.
+type Metadata struct {
+	Pos         int
+	Unit        string
+	Description string
+	Min         *float64
+	Max         *float64
+	Color       string
+}
+
+// Marker is an annotation at Timestamp. The bundled frontend does not draw
+// markers yet, clients render them from the message.
+type Marker struct {
+	ID        string
+	Type      string
+	Ref       string
+	Timestamp int64
+}
+
 type Data struct {
-	Series []Series `msg:"rows,omitempty"`
-	Error  string   `msg:"error,omitempty"`
-	Now    uint64   `msg:"now,omitempty"`
+	Series   []Series   `msg:"rows,omitempty"`
+	Metadata []Metadata `msg:"metadata,omitempty"`
+	Markers  []Marker   `msg:"markers,omitempty"`
+	Error    string     `msg:"error,omitempty"`
+	Now      uint64     `msg:"now,omitempty"`
 }
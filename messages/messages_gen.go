@@ -43,6 +43,44 @@ func (z *Data) DecodeMsg(dc *msgp.Reader) (err error) {
 					return
 				}
 			}
+		case "metadata":
+			var zb0003 uint32
+			zb0003, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Metadata")
+				return
+			}
+			if cap(z.Metadata) >= int(zb0003) {
+				z.Metadata = (z.Metadata)[:zb0003]
+			} else {
+				z.Metadata = make([]Metadata, zb0003)
+			}
+			for za0002 := range z.Metadata {
+				err = z.Metadata[za0002].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Metadata", za0002)
+					return
+				}
+			}
+		case "markers":
+			var zb0004 uint32
+			zb0004, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Markers")
+				return
+			}
+			if cap(z.Markers) >= int(zb0004) {
+				z.Markers = (z.Markers)[:zb0004]
+			} else {
+				z.Markers = make([]Marker, zb0004)
+			}
+			for za0003 := range z.Markers {
+				err = z.Markers[za0003].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Markers", za0003)
+					return
+				}
+			}
 		case "error":
 			z.Error, err = dc.ReadString()
 			if err != nil {
@@ -69,21 +107,29 @@ func (z *Data) DecodeMsg(dc *msgp.Reader) (err error) {
 // EncodeMsg implements msgp.Encodable
 func (z *Data) EncodeMsg(en *msgp.Writer) (err error) {
 	// omitempty: check for empty values
-	zb0001Len := uint32(3)
-	var zb0001Mask uint8 /* 3 bits */
+	zb0001Len := uint32(5)
+	var zb0001Mask uint8 /* 5 bits */
 	_ = zb0001Mask
 	if z.Series == nil {
 		zb0001Len--
 		zb0001Mask |= 0x1
 	}
-	if z.Error == "" {
+	if z.Metadata == nil {
 		zb0001Len--
 		zb0001Mask |= 0x2
 	}
-	if z.Now == 0 {
+	if z.Markers == nil {
 		zb0001Len--
 		zb0001Mask |= 0x4
 	}
+	if z.Error == "" {
+		zb0001Len--
+		zb0001Mask |= 0x8
+	}
+	if z.Now == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x10
+	}
 	// variable map header, size zb0001Len
 	err = en.Append(0x80 | uint8(zb0001Len))
 	if err != nil {
@@ -112,6 +158,44 @@ func (z *Data) EncodeMsg(en *msgp.Writer) (err error) {
 		}
 	}
 	if (zb0001Mask & 0x2) == 0 { // if not empty
+		// write "metadata"
+		err = en.Append(0xa8, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61)
+		if err != nil {
+			return
+		}
+		err = en.WriteArrayHeader(uint32(len(z.Metadata)))
+		if err != nil {
+			err = msgp.WrapError(err, "Metadata")
+			return
+		}
+		for za0002 := range z.Metadata {
+			err = z.Metadata[za0002].EncodeMsg(en)
+			if err != nil {
+				err = msgp.WrapError(err, "Metadata", za0002)
+				return
+			}
+		}
+	}
+	if (zb0001Mask & 0x4) == 0 { // if not empty
+		// write "markers"
+		err = en.Append(0xa7, 0x6d, 0x61, 0x72, 0x6b, 0x65, 0x72, 0x73)
+		if err != nil {
+			return
+		}
+		err = en.WriteArrayHeader(uint32(len(z.Markers)))
+		if err != nil {
+			err = msgp.WrapError(err, "Markers")
+			return
+		}
+		for za0003 := range z.Markers {
+			err = z.Markers[za0003].EncodeMsg(en)
+			if err != nil {
+				err = msgp.WrapError(err, "Markers", za0003)
+				return
+			}
+		}
+	}
+	if (zb0001Mask & 0x8) == 0 { // if not empty
 		// write "error"
 		err = en.Append(0xa5, 0x65, 0x72, 0x72, 0x6f, 0x72)
 		if err != nil {
@@ -123,7 +207,7 @@ func (z *Data) EncodeMsg(en *msgp.Writer) (err error) {
 			return
 		}
 	}
-	if (zb0001Mask & 0x4) == 0 { // if not empty
+	if (zb0001Mask & 0x10) == 0 { // if not empty
 		// write "now"
 		err = en.Append(0xa3, 0x6e, 0x6f, 0x77)
 		if err != nil {
@@ -142,21 +226,29 @@ func (z *Data) EncodeMsg(en *msgp.Writer) (err error) {
 func (z *Data) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
 	// omitempty: check for empty values
-	zb0001Len := uint32(3)
-	var zb0001Mask uint8 /* 3 bits */
+	zb0001Len := uint32(5)
+	var zb0001Mask uint8 /* 5 bits */
 	_ = zb0001Mask
 	if z.Series == nil {
 		zb0001Len--
 		zb0001Mask |= 0x1
 	}
-	if z.Error == "" {
+	if z.Metadata == nil {
 		zb0001Len--
 		zb0001Mask |= 0x2
 	}
-	if z.Now == 0 {
+	if z.Markers == nil {
 		zb0001Len--
 		zb0001Mask |= 0x4
 	}
+	if z.Error == "" {
+		zb0001Len--
+		zb0001Mask |= 0x8
+	}
+	if z.Now == 0 {
+		zb0001Len--
+		zb0001Mask |= 0x10
+	}
 	// variable map header, size zb0001Len
 	o = append(o, 0x80|uint8(zb0001Len))
 	if zb0001Len == 0 {
@@ -175,11 +267,35 @@ func (z *Data) MarshalMsg(b []byte) (o []byte, err error) {
 		}
 	}
 	if (zb0001Mask & 0x2) == 0 { // if not empty
+		// string "metadata"
+		o = append(o, 0xa8, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61)
+		o = msgp.AppendArrayHeader(o, uint32(len(z.Metadata)))
+		for za0002 := range z.Metadata {
+			o, err = z.Metadata[za0002].MarshalMsg(o)
+			if err != nil {
+				err = msgp.WrapError(err, "Metadata", za0002)
+				return
+			}
+		}
+	}
+	if (zb0001Mask & 0x4) == 0 { // if not empty
+		// string "markers"
+		o = append(o, 0xa7, 0x6d, 0x61, 0x72, 0x6b, 0x65, 0x72, 0x73)
+		o = msgp.AppendArrayHeader(o, uint32(len(z.Markers)))
+		for za0003 := range z.Markers {
+			o, err = z.Markers[za0003].MarshalMsg(o)
+			if err != nil {
+				err = msgp.WrapError(err, "Markers", za0003)
+				return
+			}
+		}
+	}
+	if (zb0001Mask & 0x8) == 0 { // if not empty
 		// string "error"
 		o = append(o, 0xa5, 0x65, 0x72, 0x72, 0x6f, 0x72)
 		o = msgp.AppendString(o, z.Error)
 	}
-	if (zb0001Mask & 0x4) == 0 { // if not empty
+	if (zb0001Mask & 0x10) == 0 { // if not empty
 		// string "now"
 		o = append(o, 0xa3, 0x6e, 0x6f, 0x77)
 		o = msgp.AppendUint64(o, z.Now)
@@ -224,6 +340,44 @@ func (z *Data) UnmarshalMsg(bts []byte) (o []byte, err error) {
 					return
 				}
 			}
+		case "metadata":
+			var zb0003 uint32
+			zb0003, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Metadata")
+				return
+			}
+			if cap(z.Metadata) >= int(zb0003) {
+				z.Metadata = (z.Metadata)[:zb0003]
+			} else {
+				z.Metadata = make([]Metadata, zb0003)
+			}
+			for za0002 := range z.Metadata {
+				bts, err = z.Metadata[za0002].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Metadata", za0002)
+					return
+				}
+			}
+		case "markers":
+			var zb0004 uint32
+			zb0004, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Markers")
+				return
+			}
+			if cap(z.Markers) >= int(zb0004) {
+				z.Markers = (z.Markers)[:zb0004]
+			} else {
+				z.Markers = make([]Marker, zb0004)
+			}
+			for za0003 := range z.Markers {
+				bts, err = z.Markers[za0003].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Markers", za0003)
+					return
+				}
+			}
 		case "error":
 			z.Error, bts, err = msgp.ReadStringBytes(bts)
 			if err != nil {
@@ -254,10 +408,504 @@ func (z *Data) Msgsize() (s int) {
 	for za0001 := range z.Series {
 		s += z.Series[za0001].Msgsize()
 	}
+	s += 9 + msgp.ArrayHeaderSize
+	for za0002 := range z.Metadata {
+		s += z.Metadata[za0002].Msgsize()
+	}
+	s += 8 + msgp.ArrayHeaderSize
+	for za0003 := range z.Markers {
+		s += z.Markers[za0003].Msgsize()
+	}
 	s += 6 + msgp.StringPrefixSize + len(z.Error) + 4 + msgp.Uint64Size
 	return
 }
 
+// DecodeMsg implements msgp.Decodable
+func (z *Marker) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "ID":
+			z.ID, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "ID")
+				return
+			}
+		case "Type":
+			z.Type, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Type")
+				return
+			}
+		case "Ref":
+			z.Ref, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Ref")
+				return
+			}
+		case "Timestamp":
+			z.Timestamp, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "Timestamp")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Marker) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 4
+	// write "ID"
+	err = en.Append(0x84, 0xa2, 0x49, 0x44)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.ID)
+	if err != nil {
+		err = msgp.WrapError(err, "ID")
+		return
+	}
+	// write "Type"
+	err = en.Append(0xa4, 0x54, 0x79, 0x70, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Type)
+	if err != nil {
+		err = msgp.WrapError(err, "Type")
+		return
+	}
+	// write "Ref"
+	err = en.Append(0xa3, 0x52, 0x65, 0x66)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Ref)
+	if err != nil {
+		err = msgp.WrapError(err, "Ref")
+		return
+	}
+	// write "Timestamp"
+	err = en.Append(0xa9, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.Timestamp)
+	if err != nil {
+		err = msgp.WrapError(err, "Timestamp")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Marker) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 4
+	// string "ID"
+	o = append(o, 0x84, 0xa2, 0x49, 0x44)
+	o = msgp.AppendString(o, z.ID)
+	// string "Type"
+	o = append(o, 0xa4, 0x54, 0x79, 0x70, 0x65)
+	o = msgp.AppendString(o, z.Type)
+	// string "Ref"
+	o = append(o, 0xa3, 0x52, 0x65, 0x66)
+	o = msgp.AppendString(o, z.Ref)
+	// string "Timestamp"
+	o = append(o, 0xa9, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70)
+	o = msgp.AppendInt64(o, z.Timestamp)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Marker) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "ID":
+			z.ID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ID")
+				return
+			}
+		case "Type":
+			z.Type, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Type")
+				return
+			}
+		case "Ref":
+			z.Ref, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Ref")
+				return
+			}
+		case "Timestamp":
+			z.Timestamp, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Timestamp")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Marker) Msgsize() (s int) {
+	s = 1 + 3 + msgp.StringPrefixSize + len(z.ID) + 5 + msgp.StringPrefixSize + len(z.Type) + 4 + msgp.StringPrefixSize + len(z.Ref) + 10 + msgp.Int64Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Metadata) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Pos":
+			z.Pos, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "Pos")
+				return
+			}
+		case "Unit":
+			z.Unit, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Unit")
+				return
+			}
+		case "Description":
+			z.Description, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Description")
+				return
+			}
+		case "Min":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "Min")
+					return
+				}
+				z.Min = nil
+			} else {
+				if z.Min == nil {
+					z.Min = new(float64)
+				}
+				*z.Min, err = dc.ReadFloat64()
+				if err != nil {
+					err = msgp.WrapError(err, "Min")
+					return
+				}
+			}
+		case "Max":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "Max")
+					return
+				}
+				z.Max = nil
+			} else {
+				if z.Max == nil {
+					z.Max = new(float64)
+				}
+				*z.Max, err = dc.ReadFloat64()
+				if err != nil {
+					err = msgp.WrapError(err, "Max")
+					return
+				}
+			}
+		case "Color":
+			z.Color, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Color")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Metadata) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 6
+	// write "Pos"
+	err = en.Append(0x86, 0xa3, 0x50, 0x6f, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.Pos)
+	if err != nil {
+		err = msgp.WrapError(err, "Pos")
+		return
+	}
+	// write "Unit"
+	err = en.Append(0xa4, 0x55, 0x6e, 0x69, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Unit)
+	if err != nil {
+		err = msgp.WrapError(err, "Unit")
+		return
+	}
+	// write "Description"
+	err = en.Append(0xab, 0x44, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Description)
+	if err != nil {
+		err = msgp.WrapError(err, "Description")
+		return
+	}
+	// write "Min"
+	err = en.Append(0xa3, 0x4d, 0x69, 0x6e)
+	if err != nil {
+		return
+	}
+	if z.Min == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = en.WriteFloat64(*z.Min)
+		if err != nil {
+			err = msgp.WrapError(err, "Min")
+			return
+		}
+	}
+	// write "Max"
+	err = en.Append(0xa3, 0x4d, 0x61, 0x78)
+	if err != nil {
+		return
+	}
+	if z.Max == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = en.WriteFloat64(*z.Max)
+		if err != nil {
+			err = msgp.WrapError(err, "Max")
+			return
+		}
+	}
+	// write "Color"
+	err = en.Append(0xa5, 0x43, 0x6f, 0x6c, 0x6f, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Color)
+	if err != nil {
+		err = msgp.WrapError(err, "Color")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Metadata) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 6
+	// string "Pos"
+	o = append(o, 0x86, 0xa3, 0x50, 0x6f, 0x73)
+	o = msgp.AppendInt(o, z.Pos)
+	// string "Unit"
+	o = append(o, 0xa4, 0x55, 0x6e, 0x69, 0x74)
+	o = msgp.AppendString(o, z.Unit)
+	// string "Description"
+	o = append(o, 0xab, 0x44, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e)
+	o = msgp.AppendString(o, z.Description)
+	// string "Min"
+	o = append(o, 0xa3, 0x4d, 0x69, 0x6e)
+	if z.Min == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o = msgp.AppendFloat64(o, *z.Min)
+	}
+	// string "Max"
+	o = append(o, 0xa3, 0x4d, 0x61, 0x78)
+	if z.Max == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o = msgp.AppendFloat64(o, *z.Max)
+	}
+	// string "Color"
+	o = append(o, 0xa5, 0x43, 0x6f, 0x6c, 0x6f, 0x72)
+	o = msgp.AppendString(o, z.Color)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Metadata) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Pos":
+			z.Pos, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Pos")
+				return
+			}
+		case "Unit":
+			z.Unit, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Unit")
+				return
+			}
+		case "Description":
+			z.Description, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Description")
+				return
+			}
+		case "Min":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Min = nil
+			} else {
+				if z.Min == nil {
+					z.Min = new(float64)
+				}
+				*z.Min, bts, err = msgp.ReadFloat64Bytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Min")
+					return
+				}
+			}
+		case "Max":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Max = nil
+			} else {
+				if z.Max == nil {
+					z.Max = new(float64)
+				}
+				*z.Max, bts, err = msgp.ReadFloat64Bytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Max")
+					return
+				}
+			}
+		case "Color":
+			z.Color, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Color")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Metadata) Msgsize() (s int) {
+	s = 1 + 4 + msgp.IntSize + 5 + msgp.StringPrefixSize + len(z.Unit) + 12 + msgp.StringPrefixSize + len(z.Description) + 4
+	if z.Min == nil {
+		s += msgp.NilSize
+	} else {
+		s += msgp.Float64Size
+	}
+	s += 4
+	if z.Max == nil {
+		s += msgp.NilSize
+	} else {
+		s += msgp.Float64Size
+	}
+	s += 6 + msgp.StringPrefixSize + len(z.Color)
+	return
+}
+
 // DecodeMsg implements msgp.Decodable
 func (z *Series) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
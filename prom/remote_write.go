@@ -0,0 +1,196 @@
+package prom
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"sort"
+)
+
+// TimeSeries is one series of a remote_write WriteRequest
+type TimeSeries struct {
+	Labels  []Label // sorted by name, including __name__
+	Samples []RemoteSample
+}
+
+type RemoteSample struct {
+	Value     float64
+	Timestamp int64 // milliseconds
+}
+
+// Sample returns the series as a scraped sample would look, for SeriesName
+func (ts TimeSeries) Sample() Sample {
+	var s Sample
+	for _, l := range ts.Labels {
+		if l.Name == "__name__" {
+			s.Metric = l.Value
+			continue
+		}
+		s.Labels = append(s.Labels, l)
+	}
+	return s
+}
+
+// DecodeWriteRequest decodes an uncompressed remote_write 1.0 WriteRequest.
+// Metadata, exemplars and native histograms are skipped.
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; ... }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; ... }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+func DecodeWriteRequest(data []byte) ([]TimeSeries, error) {
+	var result []TimeSeries
+	err := decodeMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := decodeTimeSeries(v)
+		if err != nil {
+			return errors.Wrapf(err, "timeseries %d", len(result))
+		}
+		result = append(result, ts)
+		return nil
+	})
+	return result, err
+}
+
+func decodeTimeSeries(data []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := decodeMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			l, err := decodeLabel(v)
+			if err != nil {
+				return errors.Wrap(err, "label")
+			}
+			ts.Labels = append(ts.Labels, l)
+		case 2:
+			s, err := decodeSample(v)
+			if err != nil {
+				return errors.Wrap(err, "sample")
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+
+	sort.Slice(ts.Labels, func(i, j int) bool {
+		return ts.Labels[i].Name < ts.Labels[j].Name
+	})
+	return ts, err
+}
+
+func decodeLabel(data []byte) (Label, error) {
+	var l Label
+	err := decodeMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			l.Name = string(v)
+		case 2:
+			l.Value = string(v)
+		}
+		return nil
+	})
+	return l, err
+}
+
+func decodeSample(data []byte) (RemoteSample, error) {
+	var s RemoteSample
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return s, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			s.Value = math.Float64frombits(v)
+			data = data[n:]
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			s.Timestamp = int64(v)
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return s, nil
+}
+
+// decodeMessage calls fn with every field of a message. For length delimited
+// fields v is the contents, for other types it is nil.
+func decodeMessage(data []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var v []byte
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(data)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeWriteRequest is the inverse of DecodeWriteRequest, for clients pushing samples
+func EncodeWriteRequest(timeseries []TimeSeries) []byte {
+	var result []byte
+	for _, ts := range timeseries {
+		var msg []byte
+		for _, l := range ts.Labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.Name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.Value)
+
+			msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+			msg = protowire.AppendBytes(msg, label)
+		}
+		for _, s := range ts.Samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendBytes(msg, sample)
+		}
+
+		result = protowire.AppendTag(result, 1, protowire.BytesType)
+		result = protowire.AppendBytes(result, msg)
+	}
+	return result
+}
@@ -0,0 +1,35 @@
+package prom
+
+import (
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"testing"
+)
+
+func TestWriteRequestRoundTrip(t *testing.T) {
+	timeseries := []TimeSeries{
+		{
+			Labels: []Label{{"__name__", "http_requests_total"}, {"code", "200"}, {"job", "api"}},
+			Samples: []RemoteSample{
+				{Value: 10, Timestamp: 1700000000000},
+				{Value: -2.5, Timestamp: -1},
+			},
+		},
+		{Labels: []Label{{"__name__", "up"}}},
+	}
+
+	data := EncodeWriteRequest(timeseries)
+
+	// fields rtgraph does not use, such as metadata, are skipped
+	data = protowire.AppendTag(data, 3, protowire.BytesType)
+	data = protowire.AppendBytes(data, []byte{0x08, 0x01})
+
+	decoded, err := DecodeWriteRequest(data)
+	require.NoError(t, err)
+	require.Equal(t, timeseries, decoded)
+
+	require.Equal(t, "http_requests_total.code.200.job.api", SeriesName("", decoded[0].Sample()))
+
+	_, err = DecodeWriteRequest(data[:len(data)-1])
+	require.Error(t, err)
+}
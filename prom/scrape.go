@@ -0,0 +1,193 @@
+package prom
+
+import (
+	"context"
+	"fmt"
+	"github.com/minor-industries/rtgraph/broker"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxScrapeBody limits how much of a response is read
+const maxScrapeBody = 10 << 20
+
+type Target struct {
+	URL    string
+	Prefix string // prepended to series names, to tell apart targets exporting the same metrics
+}
+
+// Scraper polls Prometheus text format endpoints and publishes every sample as
+// a series. Labels are flattened into the name, so
+//
+//	http_requests_total{code="200",method="get"}
+//
+// becomes http_requests_total.code.200.method.get. Set it as rtgraph.Opts.Scrape.
+type Scraper struct {
+	Targets  []Target
+	Interval time.Duration // defaults to 15s
+	Client   *http.Client  // defaults to a client timing out after Interval
+
+	lock   sync.Mutex
+	newest map[string]time.Time // explicit sample timestamps per series
+}
+
+func (s *Scraper) interval() time.Duration {
+	if s.Interval <= 0 {
+		return 15 * time.Second
+	}
+	return s.Interval
+}
+
+func (s *Scraper) client() *http.Client {
+	if s.Client == nil {
+		return &http.Client{Timeout: s.interval()}
+	}
+	return s.Client
+}
+
+// Run scrapes all targets every interval until the process exits. A failing
+// target is logged and tried again on the next interval.
+func (s *Scraper) Run(br *broker.Broker, errCh chan error) {
+	ticker := time.NewTicker(s.interval())
+	defer ticker.Stop()
+
+	busy := make([]atomic.Bool, len(s.Targets))
+	for {
+		s.scrapeAll(br, busy)
+		<-ticker.C
+	}
+}
+
+// scrapeAll starts scraping every target, skipping those whose previous
+// scrape is still running so that a slow target can't pile up requests
+func (s *Scraper) scrapeAll(br *broker.Broker, busy []atomic.Bool) {
+	for i, target := range s.Targets {
+		if !busy[i].CompareAndSwap(false, true) {
+			fmt.Println("prometheus scrape", target.URL, "skipped, previous scrape still running")
+			continue
+		}
+		go func(i int, target Target) {
+			defer busy[i].Store(false)
+
+			series, err := s.Scrape(context.Background(), target, time.Now())
+			if err != nil {
+				fmt.Println("prometheus scrape", target.URL, err)
+				return
+			}
+			for _, sr := range series {
+				br.Publish(sr)
+			}
+		}(i, target)
+	}
+}
+
+// Scrape fetches one target. Samples without a timestamp get now, NaN and
+// infinite values are dropped. Samples with a timestamp that has not advanced
+// since the last scrape are dropped too, exporters repeat them until the value
+// changes.
+func (s *Scraper) Scrape(ctx context.Context, target Target, now time.Time) ([]schema.Series, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.URL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "get")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxScrapeBody+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "read body")
+	}
+	if len(body) > maxScrapeBody {
+		return nil, errors.New("body too large")
+	}
+
+	samples, err := ParseText(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse")
+	}
+
+	var result []schema.Series
+	index := map[string]int{}
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+
+		name := SeriesName(target.Prefix, sample)
+
+		ts := sample.Time
+		if ts.IsZero() {
+			ts = now
+		} else if !s.advance(name, ts) {
+			continue
+		}
+
+		i, ok := index[name]
+		if !ok {
+			i = len(result)
+			index[name] = i
+			result = append(result, schema.Series{SeriesName: name})
+		}
+		result[i].Values = append(result[i].Values, schema.Value{Timestamp: ts, Value: sample.Value})
+	}
+
+	return result, nil
+}
+
+// advance records ts as the newest timestamp of a series, reporting false when
+// it is not newer than the one already seen
+func (s *Scraper) advance(name string, ts time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.newest == nil {
+		s.newest = map[string]time.Time{}
+	}
+	if last, ok := s.newest[name]; ok && !ts.After(last) {
+		return false
+	}
+	s.newest[name] = ts
+	return true
+}
+
+// SeriesName flattens a sample to prefix.metric.label.value..., leaving out
+// empty labels. Characters that cannot appear in a bare series name become "_",
+// so label values differing only in those, such as /a and _a, share a series.
+func SeriesName(prefix string, sample Sample) string {
+	parts := []string{sample.Metric}
+	if prefix != "" {
+		parts = []string{prefix, sample.Metric}
+	}
+	for _, l := range sample.Labels {
+		if l.Value == "" {
+			continue
+		}
+		parts = append(parts, l.Name, sanitize(l.Value))
+	}
+	return strings.Join(parts, ".")
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if isLetter(r) || isDigit(r) || strings.ContainsRune("_.:-", r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
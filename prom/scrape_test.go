@@ -0,0 +1,140 @@
+package prom
+
+import (
+	"context"
+	"github.com/minor-industries/rtgraph/broker"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const exposition = `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 1027
+http_requests_total{code="500", method="get"} 3 1700000000000
+# TYPE latency histogram
+latency_bucket{le="0.5"} 10
+latency_bucket{le="+Inf"} 12
+latency_sum 4.5
+latency_count 12
+up 1
+temperature{room="living room",sensor="a\"b"} 21.5
+missing NaN
+`
+
+func TestParseText(t *testing.T) {
+	samples, err := ParseText([]byte(exposition))
+	require.NoError(t, err)
+	require.Len(t, samples, 9)
+
+	require.Equal(t, Sample{
+		Metric: "http_requests_total",
+		Labels: []Label{{"code", "500"}, {"method", "get"}},
+		Value:  3,
+		Time:   time.UnixMilli(1700000000000),
+	}, samples[1])
+	require.Equal(t, []Label{{"room", "living room"}, {"sensor", `a"b`}}, samples[7].Labels)
+
+	for _, bad := range []string{
+		"1up 1",
+		"up",
+		"up x",
+		"up 1 x",
+		`up{job=x} 1`,
+		`up{job="x" 1`,
+		`up{job="x} 1`,
+	} {
+		_, err := ParseText([]byte(bad))
+		require.Error(t, err, bad)
+	}
+}
+
+func TestScrape(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(exposition))
+	}))
+	defer srv.Close()
+
+	s := &Scraper{}
+	now := time.Unix(1700000100, 0)
+
+	series, err := s.Scrape(context.Background(), Target{URL: srv.URL + "/metrics", Prefix: "web"}, now)
+	require.NoError(t, err)
+
+	byName := map[string][]schema.Value{}
+	for _, sr := range series {
+		byName[sr.SeriesName] = sr.Values
+	}
+	require.Len(t, byName, 8)
+	require.Equal(t, []schema.Value{{Timestamp: now, Value: 1027}}, byName["web.http_requests_total.code.200.method.get"])
+	require.Equal(t, []schema.Value{{Timestamp: time.UnixMilli(1700000000000), Value: 3}}, byName["web.http_requests_total.code.500.method.get"])
+	require.Contains(t, byName, "web.latency_bucket.le._Inf")
+	require.Contains(t, byName, "web.temperature.room.living_room.sensor.a_b")
+	require.Contains(t, byName, "web.up")
+
+	// a repeated explicit timestamp is skipped, samples without one are not
+	later := now.Add(15 * time.Second)
+	series, err = s.Scrape(context.Background(), Target{URL: srv.URL + "/metrics", Prefix: "web"}, later)
+	require.NoError(t, err)
+	byName = map[string][]schema.Value{}
+	for _, sr := range series {
+		byName[sr.SeriesName] = sr.Values
+	}
+	require.Len(t, byName, 7)
+	require.NotContains(t, byName, "web.http_requests_total.code.500.method.get")
+	require.Equal(t, []schema.Value{{Timestamp: later, Value: 1027}}, byName["web.http_requests_total.code.200.method.get"])
+
+	_, err = s.Scrape(context.Background(), Target{URL: srv.URL + "/nothing"}, now)
+	require.ErrorContains(t, err, "404")
+}
+
+func TestScrapeSkipsBusyTarget(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		_, _ = w.Write([]byte("up 1\n"))
+	}))
+	defer srv.Close()
+
+	br := broker.NewBroker()
+	go br.Start()
+	defer br.Stop()
+
+	s := &Scraper{Targets: []Target{{URL: srv.URL}}}
+	busy := make([]atomic.Bool, len(s.Targets))
+
+	s.scrapeAll(br, busy)
+	require.Eventually(t, func() bool { return requests.Load() == 1 }, 2*time.Second, time.Millisecond)
+
+	// the first scrape hangs, later ticks leave the target alone
+	s.scrapeAll(br, busy)
+	s.scrapeAll(br, busy)
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, int32(1), requests.Load())
+
+	close(release)
+	require.Eventually(t, func() bool { return !busy[0].Load() }, 2*time.Second, time.Millisecond)
+	s.scrapeAll(br, busy)
+	require.Eventually(t, func() bool { return requests.Load() == 2 }, 2*time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return !busy[0].Load() }, 2*time.Second, time.Millisecond)
+}
+
+func TestSeriesNameCollisions(t *testing.T) {
+	// sanitizing can map distinct label values to one name
+	name := func(value string) string {
+		return SeriesName("", Sample{Metric: "hits", Labels: []Label{{Name: "path", Value: value}}})
+	}
+	require.Equal(t, "hits.path._a", name("/a"))
+	require.Equal(t, name("/a"), name("_a"))
+	require.NotEqual(t, name("/a"), name("/b"))
+}
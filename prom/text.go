@@ -0,0 +1,204 @@
+package prom
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/pkg/errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one line of the Prometheus text exposition format
+type Sample struct {
+	Metric string
+	Labels []Label // sorted by name
+	Value  float64
+	Time   time.Time // zero when the line has no timestamp
+}
+
+// ParseText parses the text exposition format, including histogram and summary
+// samples such as name_bucket{le="0.5"}. Comments and HELP/TYPE lines are skipped.
+func ParseText(data []byte) ([]Sample, error) {
+	var result []Sample
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		s, err := parseSample(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", lineNo)
+		}
+		result = append(result, s)
+	}
+
+	return result, errors.Wrap(scanner.Err(), "read")
+}
+
+func parseSample(line string) (Sample, error) {
+	var s Sample
+
+	end := strings.IndexAny(line, "{ \t")
+	if end < 0 {
+		return s, errors.New("missing value")
+	}
+	s.Metric = line[:end]
+	if !validMetricName(s.Metric) {
+		return s, errors.Errorf("invalid metric name %q", s.Metric)
+	}
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		labels, after, err := parseLabels(rest[1:])
+		if err != nil {
+			return s, err
+		}
+		s.Labels = labels
+		rest = after
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return s, errors.Errorf("expected value and optional timestamp, got %q", rest)
+	}
+
+	value, err := parseValue(fields[0])
+	if err != nil {
+		return s, err
+	}
+	s.Value = value
+
+	if len(fields) == 2 {
+		ms, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return s, errors.Errorf("invalid timestamp %q", fields[1])
+		}
+		s.Time = time.UnixMilli(ms)
+	}
+
+	return s, nil
+}
+
+func parseValue(s string) (float64, error) {
+	switch s {
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// parseLabels reads name="value" pairs up to the closing brace and returns the rest of the line
+func parseLabels(s string) ([]Label, string, error) {
+	var labels []Label
+
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			break
+		}
+
+		name, rest, ok := strings.Cut(s, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !validLabelName(name) {
+			return nil, "", errors.Errorf("invalid label in %q", s)
+		}
+
+		value, rest, err := quoted(strings.TrimLeft(rest, " \t"))
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "label %s", name)
+		}
+		labels = append(labels, Label{Name: name, Value: value})
+
+		s = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+			continue
+		}
+		if !strings.HasPrefix(s, "}") {
+			return nil, "", errors.Errorf("expected \",\" or \"}\" in %q", s)
+		}
+		break
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels, s[1:], nil
+}
+
+// quoted reads a double quoted label value with \\, \" and \n escapes
+func quoted(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", errors.New("value must be quoted")
+	}
+
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return sb.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				break
+			}
+			switch s[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			default:
+				sb.WriteByte(s[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated value")
+}
+
+func validMetricName(s string) bool {
+	for i, r := range s {
+		if r == '_' || r == ':' || isLetter(r) || (i > 0 && isDigit(r)) {
+			continue
+		}
+		return false
+	}
+	return s != ""
+}
+
+func validLabelName(s string) bool {
+	for i, r := range s {
+		if r == '_' || isLetter(r) || (i > 0 && isDigit(r)) {
+			continue
+		}
+		return false
+	}
+	return s != ""
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
@@ -0,0 +1,180 @@
+package rtgraph
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/snappy"
+	"github.com/minor-industries/rtgraph/prom"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRemoteWriteDecoded limits the uncompressed size of a remote_write body
+const maxRemoteWriteDecoded = 64 << 20
+
+// seriesClockTTL is how long a series is remembered after its last write.
+// Forgotten series accept any timestamp again, like new ones.
+const seriesClockTTL = 15 * time.Minute
+
+// seriesClock remembers the newest timestamp published per series. Prometheus
+// resends batches after failures and several senders may write one series, so
+// remote_write samples at or before it are dropped and counted: storage ignores
+// duplicates anyway since the sqlite primary key is (series, millisecond), and
+// subscribers expect each series in time order.
+type seriesClock struct {
+	lock      sync.Mutex
+	newest    map[string]clockEntry
+	lastSweep time.Time
+}
+
+type clockEntry struct {
+	ms       int64
+	lastSeen time.Time
+}
+
+func newSeriesClock() *seriesClock {
+	return &seriesClock{newest: map[string]clockEntry{}}
+}
+
+// accept sorts values and returns those after the newest seen, one per millisecond
+func (c *seriesClock) accept(name string, values []schema.Value, now time.Time) []schema.Value {
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].Timestamp.Before(values[j].Timestamp)
+	})
+
+	entry, seen := c.newest[name]
+	result := values[:0]
+	for _, v := range values {
+		ms := v.Timestamp.UnixMilli()
+		if seen && ms <= entry.ms {
+			continue
+		}
+		result = append(result, v)
+		entry.ms, seen = ms, true
+	}
+	if seen {
+		entry.lastSeen = now
+		c.newest[name] = entry
+	}
+	return result
+}
+
+// expire forgets series not written for seriesClockTTL, checking at most once a minute
+func (c *seriesClock) expire(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+
+	for name, entry := range c.newest {
+		if now.Sub(entry.lastSeen) > seriesClockTTL {
+			delete(c.newest, name)
+		}
+	}
+}
+
+// handleRemoteWrite receives Prometheus remote_write 1.0 requests. Series are
+// named like scraped samples, see prom.SeriesName. Stale markers are dropped.
+func (g *Graph) handleRemoteWrite(c *gin.Context) {
+	fail := func(status int, err error) {
+		c.String(status, err.Error())
+	}
+
+	if strings.Contains(c.GetHeader("Content-Type"), "io.prometheus.write.v2") {
+		fail(http.StatusUnsupportedMediaType, errors.New("only remote_write 1.0 is supported"))
+		return
+	}
+	if enc := c.GetHeader("Content-Encoding"); enc != "" && enc != "snappy" {
+		fail(http.StatusUnsupportedMediaType, errors.Errorf("unsupported content encoding %q", enc))
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxWriteBody)
+	compressed, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		fail(http.StatusBadRequest, errors.Wrap(err, "read body"))
+		return
+	}
+
+	n, err := snappy.DecodedLen(compressed)
+	if err == nil && n > maxRemoteWriteDecoded {
+		err = errors.New("decoded body too large")
+	}
+	var body []byte
+	if err == nil {
+		body, err = snappy.Decode(nil, compressed)
+	}
+	if err != nil {
+		fail(http.StatusBadRequest, errors.Wrap(err, "snappy"))
+		return
+	}
+
+	timeseries, err := prom.DecodeWriteRequest(body)
+	if err != nil {
+		fail(http.StatusBadRequest, errors.Wrap(err, "decode write request"))
+		return
+	}
+
+	batch := map[string][]schema.Value{}
+	var invalid []string
+	for _, ts := range timeseries {
+		name := prom.SeriesName("", ts.Sample())
+		if err := validSeriesName(name); err != nil {
+			invalid = append(invalid, errors.Wrapf(err, "series %q", name).Error())
+			continue
+		}
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			batch[name] = append(batch[name], schema.Value{
+				Timestamp: time.UnixMilli(s.Timestamp),
+				Value:     s.Value,
+			})
+		}
+	}
+
+	dropped, err := g.publishInOrder(batch)
+	if err != nil {
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+	if dropped > 0 {
+		fmt.Println("remote_write dropped", dropped, "samples not newer than their series")
+	}
+
+	// a 400 tells the sender not to retry, the valid series have been written
+	if len(invalid) > 0 {
+		fail(http.StatusBadRequest, errors.New(strings.Join(invalid[:min(len(invalid), maxLineErrors)], "; ")))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// publishInOrder publishes the values that move each series forward in time
+// and returns how many were dropped. The lock is held while publishing so that
+// concurrent requests cannot interleave.
+func (g *Graph) publishInOrder(batch map[string][]schema.Value) (int, error) {
+	g.remoteWrite.lock.Lock()
+	defer g.remoteWrite.lock.Unlock()
+
+	now := time.Now()
+	g.remoteWrite.expire(now)
+	dropped := 0
+	for name, values := range batch {
+		accepted := g.remoteWrite.accept(name, values, now)
+		dropped += len(values) - len(accepted)
+		if err := g.CreateValues(name, accepted); err != nil {
+			return dropped, errors.Wrapf(err, "create values for %s", name)
+		}
+	}
+	return dropped, nil
+}
@@ -0,0 +1,137 @@
+package rtgraph
+
+import (
+	"bytes"
+	"github.com/golang/snappy"
+	"github.com/minor-industries/rtgraph/prom"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func remoteWrite(r http.Handler, contentType string, timeseries ...prom.TimeSeries) *httptest.ResponseRecorder {
+	body := snappy.Encode(nil, prom.EncodeWriteRequest(timeseries))
+	req := httptest.NewRequest(http.MethodPost, "/rtgraph/api/v1/write", bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRemoteWrite(t *testing.T) {
+	_, db, r := newTestServer(t)
+
+	// remote writes are not idempotent here, so wait for the db writer first
+	require.Eventually(t, func() bool {
+		post(r, "/rtgraph/api/write", `[{"series": "ready", "timestamp": 1000, "value": 1}]`)
+		s, err := db.LoadDataAfter("ready", time.UnixMilli(0))
+		require.NoError(t, err)
+		return len(s.Values) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	const contentType = "application/x-protobuf"
+	labels := []prom.Label{{Name: "__name__", Value: "temp"}, {Name: "room", Value: "kitchen"}}
+	series := func(samples ...prom.RemoteSample) prom.TimeSeries {
+		return prom.TimeSeries{Labels: labels, Samples: samples}
+	}
+
+	w := remoteWrite(r, contentType,
+		series(
+			prom.RemoteSample{Value: 23, Timestamp: 3000},
+			prom.RemoteSample{Value: 21, Timestamp: 1000},
+			prom.RemoteSample{Value: 99, Timestamp: 1000},
+			prom.RemoteSample{Value: math.NaN(), Timestamp: 2000},
+		),
+		prom.TimeSeries{
+			Labels:  []prom.Label{{Name: "__name__", Value: "long"}, {Name: "x", Value: strings.Repeat("a", 300)}},
+			Samples: []prom.RemoteSample{{Value: 1, Timestamp: 1000}},
+		},
+	)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "longer than")
+
+	// a resent batch and a late sample are dropped, newer samples are kept
+	w = remoteWrite(r, contentType, series(prom.RemoteSample{Value: 23, Timestamp: 3000}))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = remoteWrite(r, contentType, series(
+		prom.RemoteSample{Value: 22, Timestamp: 2000},
+		prom.RemoteSample{Value: 24, Timestamp: 4000},
+	))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	waitForValues(t, db, "temp.room.kitchen", 3)
+	s, err := db.LoadDataAfter("temp.room.kitchen", time.UnixMilli(0))
+	require.NoError(t, err)
+	require.Equal(t, []schema.Value{
+		{Timestamp: time.UnixMilli(1000), Value: 21},
+		{Timestamp: time.UnixMilli(3000), Value: 23},
+		{Timestamp: time.UnixMilli(4000), Value: 24},
+	}, s.Values)
+
+	w = remoteWrite(r, "application/x-protobuf;proto=io.prometheus.write.v2.Request", series())
+	require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = post(r, "/rtgraph/api/v1/write", "not snappy")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSeriesClockExpiry(t *testing.T) {
+	c := newSeriesClock()
+	t0 := time.Unix(1700000000, 0)
+	at := func(sec int64) []schema.Value {
+		return []schema.Value{{Timestamp: time.Unix(sec, 0), Value: 1}}
+	}
+
+	require.Len(t, c.accept("a", at(100), t0), 1)
+	require.Len(t, c.accept("b", at(100), t0), 1)
+	require.Empty(t, c.accept("a", at(100), t0))
+
+	// b keeps being written, a goes quiet
+	later := t0.Add(seriesClockTTL / 2)
+	require.Len(t, c.accept("b", at(200), later), 1)
+
+	c.expire(t0.Add(seriesClockTTL + time.Second))
+	require.Len(t, c.newest, 1)
+	require.Contains(t, c.newest, "b")
+
+	// a forgotten series starts over
+	require.Len(t, c.accept("a", at(50), t0.Add(seriesClockTTL+time.Second)), 1)
+
+	// sweeps are at least a minute apart
+	sweep := t0.Add(10 * seriesClockTTL)
+	c.expire(sweep)
+	require.Empty(t, c.newest)
+	require.Len(t, c.accept("a", at(60), t0), 1)
+	c.expire(sweep.Add(time.Second))
+	require.Len(t, c.newest, 1)
+	c.expire(sweep.Add(time.Minute))
+	require.Empty(t, c.newest)
+}
+
+func TestPublishInOrderCountsDrops(t *testing.T) {
+	g, _, _ := newTestServer(t)
+	at := func(ms ...int64) []schema.Value {
+		var result []schema.Value
+		for _, m := range ms {
+			result = append(result, schema.Value{Timestamp: time.UnixMilli(m), Value: 1})
+		}
+		return result
+	}
+
+	dropped, err := g.publishInOrder(map[string][]schema.Value{"a": at(2000, 1000, 1000)})
+	require.NoError(t, err)
+	require.Equal(t, 1, dropped)
+
+	dropped, err = g.publishInOrder(map[string][]schema.Value{
+		"a": at(1500, 2000, 3000),
+		"b": at(1000),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, dropped)
+}
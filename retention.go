@@ -0,0 +1,91 @@
+package rtgraph
+
+import (
+	"github.com/pkg/errors"
+	"path"
+	"time"
+)
+
+const defaultPruneInterval = time.Minute
+
+// RetentionRule overrides the default retention for series whose name matches Pattern.
+// Pattern uses path.Match syntax, e.g. "heartrate_*".
+type RetentionRule struct {
+	Pattern string
+	MaxAge  time.Duration // zero keeps matching series forever
+}
+
+// RetentionPolicy controls how long samples are kept before being pruned.
+type RetentionPolicy struct {
+	Default  time.Duration   // zero keeps data forever
+	Rules    []RetentionRule // first matching rule wins
+	Interval time.Duration   // how often to prune, defaults to one minute
+}
+
+func (p *RetentionPolicy) enabled() bool {
+	if p.Default > 0 {
+		return true
+	}
+	for _, rule := range p.Rules {
+		if rule.MaxAge > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetentionPolicy) validate() error {
+	for _, rule := range p.Rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid retention pattern %q", rule.Pattern)
+		}
+	}
+	return nil
+}
+
+// MaxAge returns the retention for a series, or zero if it should be kept forever.
+func (p *RetentionPolicy) MaxAge(seriesName string) time.Duration {
+	for _, rule := range p.Rules {
+		if ok, _ := path.Match(rule.Pattern, seriesName); ok {
+			return rule.MaxAge
+		}
+	}
+	return p.Default
+}
+
+func (g *Graph) enforceRetention(policy RetentionPolicy) {
+	interval := policy.Interval
+	if interval <= 0 {
+		interval = defaultPruneInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := g.prune(&policy, now); err != nil {
+			g.errCh <- errors.Wrap(err, "enforce retention")
+			return
+		}
+	}
+}
+
+func (g *Graph) prune(policy *RetentionPolicy, now time.Time) error {
+	names, err := g.db.AllSeriesNames()
+	if err != nil {
+		return errors.Wrap(err, "get series names")
+	}
+
+	for _, name := range names {
+		maxAge := policy.MaxAge(name)
+		if maxAge <= 0 {
+			continue
+		}
+
+		if err := g.db.DeleteBefore(name, now.Add(-maxAge)); err != nil {
+			return errors.Wrapf(err, "delete old values for %s", name)
+		}
+	}
+
+	return nil
+}
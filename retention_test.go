@@ -0,0 +1,62 @@
+package rtgraph
+
+import (
+	"github.com/minor-industries/rtgraph/database/inmem"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyMaxAge(t *testing.T) {
+	policy := RetentionPolicy{
+		Default: 24 * time.Hour,
+		Rules: []RetentionRule{
+			{Pattern: "debug_*", MaxAge: time.Hour},
+			{Pattern: "archive_*", MaxAge: 0},
+		},
+	}
+
+	require.NoError(t, policy.validate())
+	require.True(t, policy.enabled())
+
+	require.Equal(t, time.Hour, policy.MaxAge("debug_temp"))
+	require.Equal(t, time.Duration(0), policy.MaxAge("archive_power"))
+	require.Equal(t, 24*time.Hour, policy.MaxAge("sample1"))
+
+	require.False(t, (&RetentionPolicy{}).enabled())
+	require.Error(t, (&RetentionPolicy{Rules: []RetentionRule{{Pattern: "["}}}).validate())
+}
+
+func TestPrune(t *testing.T) {
+	db := inmem.NewBackend()
+	policy := RetentionPolicy{
+		Default:  time.Hour,
+		Rules:    []RetentionRule{{Pattern: "archive_*"}},
+		Interval: 10 * time.Millisecond,
+	}
+	_, err := New(db, make(chan error, 1), Opts{Retention: policy})
+	require.NoError(t, err)
+
+	now := time.Now()
+	old := schema.Value{Timestamp: now.Add(-2 * time.Hour), Value: 1}
+	recent := schema.Value{Timestamp: now.Add(-time.Minute), Value: 2}
+	for _, name := range []string{"temp", "archive_temp"} {
+		require.NoError(t, db.InsertSeries(schema.Series{SeriesName: name, Values: []schema.Value{old, recent}}))
+	}
+
+	// pruned by the background loop
+	require.Eventually(t, func() bool {
+		s, err := db.LoadDataAfter("temp", time.UnixMilli(0))
+		require.NoError(t, err)
+		return len(s.Values) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	s, err := db.LoadDataAfter("temp", time.UnixMilli(0))
+	require.NoError(t, err)
+	require.Equal(t, []schema.Value{recent}, s.Values)
+
+	s, err = db.LoadDataAfter("archive_temp", time.UnixMilli(0))
+	require.NoError(t, err)
+	require.Equal(t, []schema.Value{old, recent}, s.Values)
+}
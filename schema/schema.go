@@ -7,6 +7,23 @@ type Value struct {
 	Value     float64
 }
 
+// SeriesMetadata describes a series and how it should be displayed
+type SeriesMetadata struct {
+	Unit        string
+	Description string
+	Min         *float64 // display range hints, nil when unset
+	Max         *float64
+	Color       string
+}
+
+func (m SeriesMetadata) IsZero() bool {
+	return m.Unit == "" &&
+		m.Description == "" &&
+		m.Min == nil &&
+		m.Max == nil &&
+		m.Color == ""
+}
+
 type Series struct {
 	SeriesName string
 	Values     []Value
@@ -15,3 +32,15 @@ type Series struct {
 func (s Series) Name() string {
 	return "series"
 }
+
+// Marker annotates a point in time, e.g. a deploy or the start of a workout interval
+type Marker struct {
+	ID        string
+	Type      string
+	Ref       string
+	Timestamp time.Time
+}
+
+func (m Marker) Name() string {
+	return "marker"
+}
@@ -1,6 +1,7 @@
 package rtgraph
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -19,12 +20,19 @@ func (g *Graph) SetupServer(rg *gin.RouterGroup) {
 		switch filepath {
 		case "/ws":
 			g.handleWebSocket(c)
+		case "/api/functions":
+			c.JSON(http.StatusOK, g.Parser.Functions())
 		case "/":
 			c.Status(http.StatusNotFound)
 		default:
 			c.FileFromFS("rtgraph"+filepath, http.FS(assets.FS))
 		}
 	})
+
+	rg.POST("/api/write", g.handleWrite)
+	rg.POST("/api/v2/write", g.handleInfluxWrite(true))
+	rg.POST("/write", g.handleInfluxWrite(false))
+	rg.POST("/api/v1/write", g.handleRemoteWrite)
 }
 
 // Separate function to handle WebSocket connections
@@ -48,7 +56,6 @@ func (g *Graph) handleWebSocket(c *gin.Context) {
 		fmt.Println("ws read error", err.Error())
 		return
 	}
-	conn.CloseRead(ctx)
 
 	var req subscription.Request
 	err = json.Unmarshal(reqBytes, &req)
@@ -57,11 +64,16 @@ func (g *Graph) handleWebSocket(c *gin.Context) {
 		return
 	}
 
+	// every later message from the client is a control message, the
+	// subscription ends once the connection can no longer be read
+	ctrlCh := make(chan subscription.Control)
+	go readControl(ctx, conn, ctrlCh)
+
 	msgCh := make(chan *messages.Data)
 	now := time.Now()
 
 	go func() {
-		g.Subscribe(&req, now, msgCh)
+		g.SubscribeWithControl(&req, now, msgCh, ctrlCh)
 		close(msgCh)
 	}()
 
@@ -69,12 +81,47 @@ func (g *Graph) handleWebSocket(c *gin.Context) {
 		binmsg, err := data.MarshalMsg(nil)
 		if err != nil {
 			fmt.Println("marshal msg error", err)
+			go drain(msgCh)
 			return
 		}
 
 		if err := conn.Write(ctx, websocket.MessageBinary, binmsg); err != nil {
 			fmt.Println("write binary to websocket error", err)
+			go drain(msgCh)
+			return
+		}
+	}
+}
+
+func readControl(
+	ctx context.Context,
+	conn *websocket.Conn,
+	ctrlCh chan subscription.Control,
+) {
+	defer close(ctrlCh)
+
+	for {
+		_, b, err := conn.Read(ctx)
+		if err != nil {
 			return
 		}
+
+		var ctrl subscription.Control
+		if err := json.Unmarshal(b, &ctrl); err != nil {
+			fmt.Println("ws control error", err.Error())
+			continue
+		}
+
+		select {
+		case ctrlCh <- ctrl:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drain lets a subscription run to completion after its connection fails
+func drain(msgCh chan *messages.Data) {
+	for range msgCh {
 	}
 }
@@ -0,0 +1,238 @@
+// Package statsd parses StatsD metrics and aggregates them per flush interval.
+//
+// Each flush produces, for a metric called name:
+//
+//	counters  counters.name.count (total, corrected for sample rate) and counters.name.rate (per second)
+//	gauges    gauges.name, repeated every flush once set
+//	timers    timers.name.count (corrected for sample rate), timers.name.mean, .min, .max and .p90
+//	sets      sets.name, the number of distinct values seen
+//
+// The prefixes keep metrics of different types that share a name apart.
+package statsd
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/pkg/errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Metric struct {
+	Name       string
+	Value      float64
+	Type       string // c, g, ms, h, d or s
+	SampleRate float64
+	Relative   bool   // gauge change such as +5 or -3
+	Raw        string // value as sent, sets count distinct raw values
+}
+
+// Parse parses a packet of newline separated metrics, "name:value|type[|@rate][|#tags]".
+// Several values may share a name, "name:1|c:2|c".
+func Parse(packet string) ([]Metric, []error) {
+	var metrics []Metric
+	var errs []error
+
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			errs = append(errs, errors.Errorf("invalid metric %q", line))
+			continue
+		}
+
+		// tags may contain ":" and are ignored
+		rest, _, _ = strings.Cut(rest, "|#")
+
+		for _, part := range strings.Split(rest, ":") {
+			m, err := parseValue(name, part)
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "metric %s", name))
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+	}
+
+	return metrics, errs
+}
+
+var timerStats = []string{"count", "mean", "min", "max", "p90"}
+
+// SeriesNames returns the series a metric is flushed to
+func (m Metric) SeriesNames() []string {
+	switch m.Type {
+	case "c":
+		return []string{"counters." + m.Name + ".count", "counters." + m.Name + ".rate"}
+	case "g":
+		return []string{"gauges." + m.Name}
+	case "s":
+		return []string{"sets." + m.Name}
+	}
+
+	var names []string
+	for _, stat := range timerStats {
+		names = append(names, "timers."+m.Name+"."+stat)
+	}
+	return names
+}
+
+func parseValue(name, s string) (Metric, error) {
+	fields := strings.Split(s, "|")
+	if len(fields) < 2 {
+		return Metric{}, errors.Errorf("missing type in %q", s)
+	}
+
+	m := Metric{Name: name, Type: fields[1], SampleRate: 1, Raw: fields[0]}
+
+	switch m.Type {
+	case "c", "g", "ms", "h", "d", "s":
+	default:
+		return Metric{}, errors.Errorf("unknown type %q", m.Type)
+	}
+
+	for _, opt := range fields[2:] {
+		if rate, ok := strings.CutPrefix(opt, "@"); ok {
+			r, err := strconv.ParseFloat(rate, 64)
+			if err != nil || r <= 0 || r > 1 {
+				return Metric{}, errors.Errorf("invalid sample rate %q", rate)
+			}
+			m.SampleRate = r
+		}
+	}
+
+	if m.Type == "s" {
+		return m, nil
+	}
+
+	m.Relative = m.Type == "g" && (strings.HasPrefix(m.Raw, "+") || strings.HasPrefix(m.Raw, "-"))
+
+	v, err := strconv.ParseFloat(m.Raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return Metric{}, errors.Errorf("invalid value %q", m.Raw)
+	}
+	m.Value = v
+
+	return m, nil
+}
+
+// Aggregator collects metrics between flushes. It is safe for concurrent use.
+type Aggregator struct {
+	lock      sync.Mutex
+	lastFlush time.Time
+
+	counters map[string]float64 // known counters stay, reported as 0 when idle
+	gauges   map[string]float64
+	timers   map[string]*timer
+	sets     map[string]map[string]bool
+}
+
+type timer struct {
+	values []float64
+	count  float64 // corrected for sample rate
+}
+
+func NewAggregator(now time.Time) *Aggregator {
+	return &Aggregator{
+		lastFlush: now,
+		counters:  map[string]float64{},
+		gauges:    map[string]float64{},
+		timers:    map[string]*timer{},
+		sets:      map[string]map[string]bool{},
+	}
+}
+
+func (a *Aggregator) Add(metrics []Metric) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, m := range metrics {
+		switch m.Type {
+		case "c":
+			a.counters[m.Name] += m.Value / m.SampleRate
+		case "g":
+			if m.Relative {
+				a.gauges[m.Name] += m.Value
+			} else {
+				a.gauges[m.Name] = m.Value
+			}
+		case "ms", "h", "d":
+			t := a.timers[m.Name]
+			if t == nil {
+				t = &timer{}
+				a.timers[m.Name] = t
+			}
+			t.values = append(t.values, m.Value)
+			t.count += 1 / m.SampleRate
+		case "s":
+			if a.sets[m.Name] == nil {
+				a.sets[m.Name] = map[string]bool{}
+			}
+			a.sets[m.Name][m.Raw] = true
+		}
+	}
+}
+
+// Flush returns one value per series for the interval since the last flush
+// and starts a new interval
+func (a *Aggregator) Flush(now time.Time) []schema.Series {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var result []schema.Series
+	emit := func(name string, value float64) {
+		result = append(result, schema.Series{
+			SeriesName: name,
+			Values:     []schema.Value{{Timestamp: now, Value: value}},
+		})
+	}
+
+	interval := now.Sub(a.lastFlush).Seconds()
+	a.lastFlush = now
+
+	for name, count := range a.counters {
+		emit("counters."+name+".count", count)
+		if interval > 0 {
+			emit("counters."+name+".rate", count/interval)
+		}
+		a.counters[name] = 0
+	}
+
+	for name, value := range a.gauges {
+		emit("gauges."+name, value)
+	}
+
+	for name, t := range a.timers {
+		values := t.values
+		slices.Sort(values)
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		prefix := "timers." + name
+		emit(prefix+".count", t.count)
+		emit(prefix+".mean", sum/float64(len(values)))
+		emit(prefix+".min", values[0])
+		emit(prefix+".max", values[len(values)-1])
+		emit(prefix+".p90", values[int(math.Ceil(0.9*float64(len(values))))-1])
+	}
+	clear(a.timers)
+
+	for name, values := range a.sets {
+		emit("sets."+name, float64(len(values)))
+	}
+	clear(a.sets)
+
+	slices.SortFunc(result, func(x, y schema.Series) int {
+		return strings.Compare(x.SeriesName, y.SeriesName)
+	})
+
+	return result
+}
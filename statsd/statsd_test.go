@@ -0,0 +1,78 @@
+package statsd
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	metrics, errs := Parse("hits:2|c|@0.5|#env:prod\nqueue:+3|g\nlatency:10|ms:20|ms\nusers:alice|s\nbad\nx:1|q\ny:1|c|@2\n")
+	require.Len(t, errs, 3)
+	require.Equal(t, []Metric{
+		{Name: "hits", Value: 2, Type: "c", SampleRate: 0.5, Raw: "2"},
+		{Name: "queue", Value: 3, Type: "g", SampleRate: 1, Relative: true, Raw: "+3"},
+		{Name: "latency", Value: 10, Type: "ms", SampleRate: 1, Raw: "10"},
+		{Name: "latency", Value: 20, Type: "ms", SampleRate: 1, Raw: "20"},
+		{Name: "users", Type: "s", SampleRate: 1, Raw: "alice"},
+	}, metrics)
+}
+
+func flushed(series []schema.Series) map[string]float64 {
+	result := map[string]float64{}
+	for _, s := range series {
+		result[s.SeriesName] = s.Values[0].Value
+	}
+	return result
+}
+
+func TestAggregator(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	a := NewAggregator(t0)
+
+	metrics, errs := Parse("hits:2|c|@0.5\nhits:1|c\nqueue:10|g\nqueue:-4|g\nusers:a|s\nusers:b|s\nusers:a|s")
+	require.Empty(t, errs)
+	a.Add(metrics)
+	for i := 1; i <= 10; i++ {
+		a.Add([]Metric{{Name: "latency", Type: "ms", Value: float64(i), SampleRate: 1}})
+	}
+
+	// a timer sharing a counter's name, sampled at 10%
+	metrics, errs = Parse("hits:7|ms|@0.1")
+	require.Empty(t, errs)
+	a.Add(metrics)
+
+	out := a.Flush(t0.Add(10 * time.Second))
+	require.Equal(t, t0.Add(10*time.Second), out[0].Values[0].Timestamp)
+	require.Equal(t, map[string]float64{
+		"counters.hits.count":  5,
+		"counters.hits.rate":   0.5,
+		"gauges.queue":         6,
+		"sets.users":           2,
+		"timers.latency.count": 10,
+		"timers.latency.mean":  5.5,
+		"timers.latency.min":   1,
+		"timers.latency.max":   10,
+		"timers.latency.p90":   9,
+		"timers.hits.count":    10,
+		"timers.hits.mean":     7,
+		"timers.hits.min":      7,
+		"timers.hits.max":      7,
+		"timers.hits.p90":      7,
+	}, flushed(out))
+
+	for _, m := range metrics {
+		for _, name := range m.SeriesNames() {
+			require.Contains(t, flushed(out), name)
+		}
+	}
+
+	// counters report zero and gauges repeat, timers and sets start over
+	out = a.Flush(t0.Add(20 * time.Second))
+	require.Equal(t, map[string]float64{
+		"counters.hits.count": 0,
+		"counters.hits.rate":  0,
+		"gauges.queue":        6,
+	}, flushed(out))
+}
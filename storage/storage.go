@@ -28,4 +28,57 @@ type StorageBackend interface {
 		timestamp time.Time,
 		value float64,
 	) error
+
+	InsertSeries(
+		series schema.Series,
+	) error
+
+	DeleteBefore(
+		seriesName string,
+		cutoff time.Time,
+	) error
+
+	SetMetadata(
+		seriesName string,
+		metadata schema.SeriesMetadata,
+	) error
+
+	// LoadMetadata returns zero metadata for series that have none
+	LoadMetadata(
+		seriesName string,
+	) (schema.SeriesMetadata, error)
+
+	InsertMarker(
+		marker schema.Marker,
+	) error
+
+	// LoadMarkersAfter and LoadMarkersBetween return markers ordered by timestamp
+	LoadMarkersAfter(
+		start time.Time,
+	) ([]schema.Marker, error)
+
+	LoadMarkersBetween(
+		start time.Time,
+		end time.Time,
+	) ([]schema.Marker, error)
+}
+
+// RollupBackend is implemented by backends that keep downsampled copies of
+// each series. Values returned are bucket averages, timestamped at the start
+// of each bucket.
+type RollupBackend interface {
+	RollupResolutions() []time.Duration
+
+	LoadRollupAfter(
+		seriesName string,
+		resolution time.Duration,
+		start time.Time,
+	) (schema.Series, error)
+
+	LoadRollupBetween(
+		seriesName string,
+		resolution time.Duration,
+		start time.Time,
+		end time.Time,
+	) (schema.Series, error)
 }
@@ -0,0 +1,307 @@
+// Package storagetest checks a storage.StorageBackend against the behaviour
+// the rest of rtgraph relies on. Backend implementations call Run from their
+// own tests.
+package storagetest
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/minor-industries/rtgraph/storage"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// Harness describes the backend under test.
+type Harness struct {
+	// New returns an empty backend. It is called once per subtest.
+	New func(t *testing.T) storage.StorageBackend
+
+	// Sync blocks until all previous writes to the backend are visible to
+	// reads. It may be nil for backends that write synchronously.
+	Sync func(t *testing.T, backend storage.StorageBackend)
+}
+
+func (h Harness) sync(t *testing.T, backend storage.StorageBackend) {
+	if h.Sync != nil {
+		h.Sync(t, backend)
+	}
+}
+
+var t0 = time.UnixMilli(1_700_000_000_000)
+
+func at(ms int64) time.Time {
+	return t0.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func series(name string, points ...int64) schema.Series {
+	result := schema.Series{SeriesName: name}
+	for _, ms := range points {
+		result.Values = append(result.Values, schema.Value{
+			Timestamp: at(ms),
+			Value:     float64(ms),
+		})
+	}
+	return result
+}
+
+// offsets converts loaded values back into millisecond offsets from t0
+func offsets(t *testing.T, s schema.Series) []int64 {
+	result := make([]int64, 0, len(s.Values))
+	for _, v := range s.Values {
+		ms := v.Timestamp.Sub(t0).Milliseconds()
+		require.Equal(t, float64(ms), v.Value, "value at offset %d", ms)
+		result = append(result, ms)
+	}
+	return result
+}
+
+// Run executes the conformance suite against the backend described by h.
+func Run(t *testing.T, h Harness) {
+	cases := []struct {
+		name string
+		fn   func(t *testing.T, h Harness, b storage.StorageBackend)
+	}{
+		{"ReadAfterWrite", testReadAfterWrite},
+		{"Ordering", testOrdering},
+		{"RangeBoundaries", testRangeBoundaries},
+		{"DuplicateTimestamps", testDuplicateTimestamps},
+		{"SeriesIsolation", testSeriesIsolation},
+		{"UnknownSeries", testUnknownSeries},
+		{"SeriesListing", testSeriesListing},
+		{"DeleteBefore", testDeleteBefore},
+		{"Metadata", testMetadata},
+		{"Markers", testMarkers},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.fn(t, h, h.New(t))
+		})
+	}
+}
+
+func testReadAfterWrite(t *testing.T, h Harness, b storage.StorageBackend) {
+	require.NoError(t, b.InsertValue("s", at(0), 0))
+	require.NoError(t, b.InsertSeries(series("s", 1, 2, 3)))
+	h.sync(t, b)
+
+	loaded, err := b.LoadDataAfter("s", t0)
+	require.NoError(t, err)
+	require.Equal(t, "s", loaded.SeriesName)
+	require.Equal(t, []int64{0, 1, 2, 3}, offsets(t, loaded))
+
+	require.NoError(t, b.InsertValue("s", at(4), 4))
+	h.sync(t, b)
+
+	loaded, err = b.LoadDataAfter("s", t0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{0, 1, 2, 3, 4}, offsets(t, loaded))
+}
+
+func testOrdering(t *testing.T, h Harness, b storage.StorageBackend) {
+	require.NoError(t, b.InsertSeries(series("s", 50, 10, 40)))
+	require.NoError(t, b.InsertValue("s", at(30), 30))
+	require.NoError(t, b.InsertValue("s", at(0), 0))
+	h.sync(t, b)
+
+	loaded, err := b.LoadDataAfter("s", t0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{0, 10, 30, 40, 50}, offsets(t, loaded))
+}
+
+func testRangeBoundaries(t *testing.T, h Harness, b storage.StorageBackend) {
+	require.NoError(t, b.InsertSeries(series("s", 0, 10, 20, 30, 40)))
+	h.sync(t, b)
+
+	// LoadDataAfter includes start
+	after, err := b.LoadDataAfter("s", at(20))
+	require.NoError(t, err)
+	require.Equal(t, []int64{20, 30, 40}, offsets(t, after))
+
+	// LoadDataBetween is half-open: [start, end)
+	between, err := b.LoadDataBetween("s", at(10), at(30))
+	require.NoError(t, err)
+	require.Equal(t, []int64{10, 20}, offsets(t, between))
+
+	between, err = b.LoadDataBetween("s", at(11), at(29))
+	require.NoError(t, err)
+	require.Equal(t, []int64{20}, offsets(t, between))
+
+	empty, err := b.LoadDataBetween("s", at(20), at(20))
+	require.NoError(t, err)
+	require.Empty(t, empty.Values)
+
+	empty, err = b.LoadDataAfter("s", at(41))
+	require.NoError(t, err)
+	require.Empty(t, empty.Values)
+}
+
+func testDuplicateTimestamps(t *testing.T, h Harness, b storage.StorageBackend) {
+	require.NoError(t, b.InsertSeries(series("s", 0, 10)))
+	h.sync(t, b)
+
+	// the first value written for a timestamp wins
+	require.NoError(t, b.InsertValue("s", at(10), 99))
+	require.NoError(t, b.InsertSeries(schema.Series{
+		SeriesName: "s",
+		Values: []schema.Value{
+			{Timestamp: at(0), Value: 99},
+			{Timestamp: at(20), Value: 20},
+		},
+	}))
+	h.sync(t, b)
+
+	loaded, err := b.LoadDataAfter("s", t0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{0, 10, 20}, offsets(t, loaded))
+}
+
+func testSeriesIsolation(t *testing.T, h Harness, b storage.StorageBackend) {
+	require.NoError(t, b.InsertSeries(series("a", 0, 10)))
+	require.NoError(t, b.InsertSeries(series("b", 5, 15)))
+	h.sync(t, b)
+
+	a, err := b.LoadDataAfter("a", t0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{0, 10}, offsets(t, a))
+
+	bs, err := b.LoadDataBetween("b", t0, at(100))
+	require.NoError(t, err)
+	require.Equal(t, "b", bs.SeriesName)
+	require.Equal(t, []int64{5, 15}, offsets(t, bs))
+}
+
+func testUnknownSeries(t *testing.T, h Harness, b storage.StorageBackend) {
+	after, err := b.LoadDataAfter("missing", t0)
+	require.NoError(t, err)
+	require.Equal(t, "missing", after.SeriesName)
+	require.Empty(t, after.Values)
+
+	between, err := b.LoadDataBetween("missing", t0, at(100))
+	require.NoError(t, err)
+	require.Empty(t, between.Values)
+}
+
+func testSeriesListing(t *testing.T, h Harness, b storage.StorageBackend) {
+	names, err := b.AllSeriesNames()
+	require.NoError(t, err)
+	require.Empty(t, names)
+
+	require.NoError(t, b.CreateSeries([]string{"created1", "created2"}))
+	require.NoError(t, b.CreateSeries([]string{"created1"}))
+	require.NoError(t, b.InsertValue("inserted", at(0), 0))
+	require.NoError(t, b.InsertSeries(series("batched", 0)))
+	h.sync(t, b)
+
+	names, err = b.AllSeriesNames()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"created1", "created2", "inserted", "batched"}, names)
+}
+
+func testDeleteBefore(t *testing.T, h Harness, b storage.StorageBackend) {
+	require.NoError(t, b.InsertSeries(series("s", 0, 10, 20, 30)))
+	require.NoError(t, b.InsertSeries(series("other", 0, 10)))
+	h.sync(t, b)
+
+	// the cutoff itself is kept
+	require.NoError(t, b.DeleteBefore("s", at(20)))
+	h.sync(t, b)
+
+	loaded, err := b.LoadDataAfter("s", t0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{20, 30}, offsets(t, loaded))
+
+	other, err := b.LoadDataAfter("other", t0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{0, 10}, offsets(t, other))
+}
+
+func testMetadata(t *testing.T, h Harness, b storage.StorageBackend) {
+	md, err := b.LoadMetadata("s")
+	require.NoError(t, err)
+	require.True(t, md.IsZero())
+
+	require.NoError(t, b.InsertValue("s", at(0), 0))
+	h.sync(t, b)
+
+	lo, hi := -10.0, 40.0
+	want := schema.SeriesMetadata{
+		Unit:        "C",
+		Description: "outdoor temperature",
+		Min:         &lo,
+		Max:         &hi,
+		Color:       "#ff0000",
+	}
+	require.NoError(t, b.SetMetadata("s", want))
+	h.sync(t, b)
+
+	md, err = b.LoadMetadata("s")
+	require.NoError(t, err)
+	require.Equal(t, want, md)
+
+	// later writes to the series keep its metadata
+	require.NoError(t, b.InsertValue("s", at(1), 1))
+	require.NoError(t, b.CreateSeries([]string{"s"}))
+	h.sync(t, b)
+
+	md, err = b.LoadMetadata("s")
+	require.NoError(t, err)
+	require.Equal(t, want, md)
+
+	// metadata may be set before any values are written
+	require.NoError(t, b.SetMetadata("fresh", schema.SeriesMetadata{Unit: "W"}))
+	h.sync(t, b)
+
+	md, err = b.LoadMetadata("fresh")
+	require.NoError(t, err)
+	require.Equal(t, "W", md.Unit)
+	require.Nil(t, md.Min)
+
+	names, err := b.AllSeriesNames()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"s", "fresh"}, names)
+}
+
+func testMarkers(t *testing.T, h Harness, b storage.StorageBackend) {
+	marker := func(id string, ms int64) schema.Marker {
+		return schema.Marker{
+			ID:        id,
+			Type:      "deploy",
+			Ref:       "ref-" + id,
+			Timestamp: at(ms),
+		}
+	}
+
+	ids := func(markers []schema.Marker) []string {
+		result := make([]string, 0, len(markers))
+		for _, m := range markers {
+			result = append(result, m.ID)
+		}
+		return result
+	}
+
+	for _, m := range []schema.Marker{
+		marker("c", 30),
+		marker("a", 10),
+		marker("b", 20),
+		marker("a", 40), // duplicate id, the first write wins
+	} {
+		require.NoError(t, b.InsertMarker(m))
+	}
+	h.sync(t, b)
+
+	all, err := b.LoadMarkersAfter(t0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, ids(all))
+	require.Equal(t, "deploy", all[0].Type)
+	require.Equal(t, "ref-a", all[0].Ref)
+	require.True(t, at(10).Equal(all[0].Timestamp))
+
+	after, err := b.LoadMarkersAfter(at(20))
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c"}, ids(after))
+
+	between, err := b.LoadMarkersBetween(at(10), at(30))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, ids(between))
+}
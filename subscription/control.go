@@ -0,0 +1,406 @@
+package subscription
+
+import (
+	"github.com/minor-industries/rtgraph/computed_series"
+	"github.com/minor-industries/rtgraph/messages"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/minor-industries/rtgraph/storage"
+	"github.com/pkg/errors"
+	"sort"
+	"time"
+)
+
+// Control is a message from the client that changes a running subscription.
+//
+// Positions are stable for the lifetime of a subscription: removed series
+// leave a gap and added series are appended after every position handed out
+// so far, in the order given.
+type Control struct {
+	// Op is one of addSeries, removeSeries, setWindow, pause, resume or history
+	Op string `json:"op"`
+
+	Series     []string `json:"series"`     // addSeries
+	Positions  []int    `json:"positions"`  // removeSeries, history (all positions if empty)
+	WindowSize uint64   `json:"windowSize"` // setWindow, in milliseconds
+	Start      TimeSpec `json:"start"`      // history
+	End        TimeSpec `json:"end"`        // history
+}
+
+func (sub *Subscription) handleControl(
+	db storage.StorageBackend,
+	ctrl Control,
+	outMsg chan *messages.Data,
+	now time.Time,
+) error {
+	switch ctrl.Op {
+	case "addSeries":
+		data, err := sub.addSeries(db, ctrl.Series, now)
+		if err != nil {
+			return err
+		}
+		sub.send(outMsg, data)
+	case "removeSeries":
+		return sub.removeSeries(ctrl.Positions)
+	case "setWindow":
+		data, err := sub.setWindow(db, ctrl.WindowSize, now)
+		if err != nil {
+			return err
+		}
+		sub.send(outMsg, data)
+	case "pause":
+		sub.paused = true
+	case "resume":
+		sub.paused = false
+		if err := sub.resume(db, outMsg); err != nil {
+			return err
+		}
+	case "history":
+		loc, err := sub.req.location()
+		if err != nil {
+			return err
+		}
+		start, err := ctrl.Start.Resolve(now, loc)
+		if err != nil {
+			return errors.Wrap(err, "start")
+		}
+		// later points are streamed live, loading them too would repeat them
+		end := sub.rng.Start
+		if ctrl.End != "" {
+			end, err = ctrl.End.Resolve(now, loc)
+			if err != nil {
+				return errors.Wrap(err, "end")
+			}
+			if end.After(sub.rng.Start) {
+				end = sub.rng.Start
+			}
+		}
+
+		positions := ctrl.Positions
+		if len(positions) == 0 {
+			positions = sub.allPositions()
+		}
+
+		data, err := sub.loadHistory(db, positions, start, end)
+		if err != nil {
+			return err
+		}
+		sub.send(outMsg, data)
+	default:
+		return errors.Errorf("unknown op %q", ctrl.Op)
+	}
+
+	return nil
+}
+
+// send delivers data unless it is empty, holding it back while paused
+func (sub *Subscription) send(outMsg chan *messages.Data, data *messages.Data) {
+	if len(data.Series) == 0 && len(data.Markers) == 0 && len(data.Metadata) == 0 {
+		return
+	}
+	if sub.paused {
+		sub.hold(data)
+		return
+	}
+	outMsg <- data
+}
+
+// maxPendingPoints bounds the points and markers held while paused. Past it
+// held data is dropped and reloaded from storage on resume.
+const maxPendingPoints = 100_000
+
+// span is an inclusive time range
+type span struct {
+	from, to time.Time
+}
+
+func (s *span) extend(t time.Time) *span {
+	if s == nil {
+		return &span{from: t, to: t}
+	}
+	if t.Before(s.from) {
+		s.from = t
+	}
+	if t.After(s.to) {
+		s.to = t
+	}
+	return s
+}
+
+func (s *span) end() time.Time {
+	return s.to.Add(time.Millisecond)
+}
+
+// hold merges data into the pending message sent on resume
+func (sub *Subscription) hold(data *messages.Data) {
+	if sub.pending == nil {
+		sub.pending = &messages.Data{}
+	}
+
+	for _, s := range data.Series {
+		sub.pendingPoints += len(s.Timestamps)
+
+		merged := false
+		for i := range sub.pending.Series {
+			p := &sub.pending.Series[i]
+			if p.Pos != s.Pos {
+				continue
+			}
+			p.Timestamps = append(p.Timestamps, s.Timestamps...)
+			p.Values = append(p.Values, s.Values...)
+			merged = true
+			break
+		}
+		if !merged {
+			sub.pending.Series = append(sub.pending.Series, s)
+		}
+	}
+
+	sub.pendingPoints += len(data.Markers)
+	sub.pending.Markers = append(sub.pending.Markers, data.Markers...)
+	sub.pending.Metadata = append(sub.pending.Metadata, data.Metadata...)
+
+	if sub.pendingPoints > maxPendingPoints {
+		sub.dropPending()
+	}
+}
+
+// dropPending forgets held series data and markers, remembering their time
+// ranges so that resume can reload them
+func (sub *Subscription) dropPending() {
+	if sub.resync == nil {
+		sub.resync = map[int]*span{}
+	}
+
+	for _, s := range sub.pending.Series {
+		for _, ms := range s.Timestamps {
+			sub.resync[s.Pos] = sub.resync[s.Pos].extend(time.UnixMilli(ms))
+		}
+	}
+	for _, m := range sub.pending.Markers {
+		sub.resyncMarkers = sub.resyncMarkers.extend(time.UnixMilli(m.Timestamp))
+	}
+
+	sub.pending = &messages.Data{Metadata: sub.pending.Metadata}
+	sub.pendingPoints = 0
+}
+
+// resume sends what was held while paused, reloading dropped data first
+func (sub *Subscription) resume(db storage.StorageBackend, outMsg chan *messages.Data) error {
+	pending := sub.pending
+	resync, resyncMarkers := sub.resync, sub.resyncMarkers
+	sub.pending, sub.pendingPoints = nil, 0
+	sub.resync, sub.resyncMarkers = nil, nil
+
+	reloaded := &messages.Data{}
+	for _, idx := range sortedPositions(resync) {
+		if !sub.validPosition(idx) {
+			continue
+		}
+		sp := resync[idx]
+		series, err := sub.loadSeriesHistory(db, []int{idx}, sp.from, sp.end())
+		if err != nil {
+			return errors.Wrap(err, "reload held data")
+		}
+		reloaded.Series = append(reloaded.Series, series...)
+	}
+	if resyncMarkers != nil {
+		markers, err := sub.loadMarkers(db, resyncMarkers.from, resyncMarkers.end())
+		if err != nil {
+			return errors.Wrap(err, "reload held markers")
+		}
+		reloaded.Markers = markers
+	}
+	sub.send(outMsg, reloaded)
+
+	if pending == nil {
+		return nil
+	}
+
+	// drop held points already covered by the reload
+	series := pending.Series[:0]
+	for _, s := range pending.Series {
+		if sp, ok := resync[s.Pos]; ok {
+			s = after(s, sp.to.UnixMilli())
+		}
+		if len(s.Timestamps) > 0 {
+			series = append(series, s)
+		}
+	}
+	pending.Series = series
+	sub.send(outMsg, pending)
+
+	return nil
+}
+
+// after keeps the points of s later than ms
+func after(s messages.Series, ms int64) messages.Series {
+	result := messages.Series{Pos: s.Pos}
+	for i, ts := range s.Timestamps {
+		if ts > ms {
+			result.Timestamps = append(result.Timestamps, ts)
+			result.Values = append(result.Values, s.Values[i])
+		}
+	}
+	return result
+}
+
+func sortedPositions(m map[int]*span) []int {
+	result := make([]int, 0, len(m))
+	for idx := range m {
+		result = append(result, idx)
+	}
+	sort.Ints(result)
+	return result
+}
+
+func (sub *Subscription) validPosition(idx int) bool {
+	return idx >= 0 && idx < len(sub.nodes) && sub.nodes[idx] != nil
+}
+
+func (sub *Subscription) addSeries(
+	db storage.StorageBackend,
+	series []string,
+	now time.Time,
+) (*messages.Data, error) {
+	nodes := make([]computed_series.Node, len(series))
+
+	// parse everything before changing the subscription so a bad expression adds nothing
+	for i, sn := range series {
+		node, err := sub.parser.ParseNode(sn, sub.rng.Start)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse series")
+		}
+		nodes[i] = node
+	}
+
+	positions := make([]int, len(series))
+	for i := range series {
+		positions[i] = len(sub.nodes)
+		sub.req.Series = append(sub.req.Series, series[i])
+		sub.nodes = append(sub.nodes, nodes[i])
+	}
+
+	data := &messages.Data{}
+	var err error
+
+	data.Series, err = sub.loadPositions(db, positions, now)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Metadata, err = sub.loadMetadata(db, positions)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (sub *Subscription) removeSeries(positions []int) error {
+	for _, idx := range positions {
+		if !sub.validPosition(idx) {
+			return errors.Errorf("invalid position %d", idx)
+		}
+	}
+
+	for _, idx := range positions {
+		sub.nodes[idx] = nil
+		delete(sub.loadedTail, idx)
+	}
+
+	return nil
+}
+
+// setWindow changes the trailing window. Growing it sends the history that
+// became visible, shrinking it sends nothing.
+func (sub *Subscription) setWindow(
+	db storage.StorageBackend,
+	windowSize uint64,
+	now time.Time,
+) (*messages.Data, error) {
+	if windowSize == 0 {
+		return nil, errors.New("windowSize is required")
+	}
+
+	windowEnd := now
+	if sub.rng.bounded() {
+		windowEnd = sub.rng.End
+	}
+
+	oldStart := sub.rng.Start
+	newStart := windowEnd.Add(-time.Duration(windowSize) * time.Millisecond)
+
+	sub.req.WindowSize = windowSize
+	sub.rng.Start = newStart
+
+	if !newStart.Before(oldStart) {
+		return &messages.Data{}, nil
+	}
+
+	return sub.loadHistory(db, sub.allPositions(), newStart, oldStart)
+}
+
+// loadHistory computes [start, end) for the given positions with fresh
+// operators, leaving the state of the live operators untouched
+func (sub *Subscription) loadHistory(
+	db storage.StorageBackend,
+	positions []int,
+	start time.Time,
+	end time.Time,
+) (*messages.Data, error) {
+	if !end.After(start) {
+		return nil, errors.New("end must be after start")
+	}
+
+	for _, idx := range positions {
+		if !sub.validPosition(idx) {
+			return nil, errors.Errorf("invalid position %d", idx)
+		}
+	}
+
+	data := &messages.Data{}
+
+	series, err := sub.loadSeriesHistory(db, positions, start, end)
+	if err != nil {
+		return nil, err
+	}
+	data.Series = series
+
+	markers, err := sub.loadMarkers(db, start, end)
+	if err != nil {
+		return nil, errors.Wrap(err, "load markers")
+	}
+	data.Markers = markers
+
+	return data, nil
+}
+
+func (sub *Subscription) loadSeriesHistory(
+	db storage.StorageBackend,
+	positions []int,
+	start time.Time,
+	end time.Time,
+) ([]messages.Series, error) {
+	var result []messages.Series
+
+	for _, idx := range positions {
+		node, err := sub.parser.ParseNode(sub.req.Series[idx], start)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse series")
+		}
+
+		from := start.Add(-computed_series.Lookback(node))
+		series, err := feedHistory(node, func(seriesName string) (schema.Series, error) {
+			return loadHistoryBetween(db, seriesName, from, end, computed_series.IsInput(node))
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "load history")
+		}
+
+		if s, ok := seriesMessage(idx, series, start, end); ok {
+			result = append(result, decimate(s, sub.req.MaxPoints, sub.req.Decimation))
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,195 @@
+package subscription
+
+import (
+	"github.com/minor-industries/rtgraph/broker"
+	"github.com/minor-industries/rtgraph/computed_series"
+	"github.com/minor-industries/rtgraph/database/inmem"
+	"github.com/minor-industries/rtgraph/messages"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestControl(t *testing.T) {
+	now := time.UnixMilli(100_000)
+
+	db := inmem.NewBackend()
+	for _, name := range []string{"a", "b"} {
+		var values []schema.Value
+		for ms := int64(0); ms < 100_000; ms += 10_000 {
+			values = append(values, schema.Value{Timestamp: time.UnixMilli(ms), Value: float64(ms)})
+		}
+		require.NoError(t, db.InsertSeries(schema.Series{SeriesName: name, Values: values}))
+	}
+
+	sub, err := newSubscription(computed_series.NewParser(), &Request{
+		Series:     []string{"a"},
+		WindowSize: 30_000,
+	}, now)
+	require.NoError(t, err)
+
+	initial, err := sub.getInitialData(db, now)
+	require.NoError(t, err)
+	require.Len(t, initial.Series, 1)
+	require.Equal(t, []int64{70_000, 80_000, 90_000}, initial.Series[0].Timestamps)
+
+	outMsg := make(chan *messages.Data, 10)
+	handle := func(ctrl Control) *messages.Data {
+		require.NoError(t, sub.handleControl(db, ctrl, outMsg, now))
+		select {
+		case data := <-outMsg:
+			return data
+		default:
+			return nil
+		}
+	}
+
+	// added series are appended and only their data is sent
+	data := handle(Control{Op: "addSeries", Series: []string{"b | add 1"}})
+	require.Len(t, data.Series, 1)
+	require.Equal(t, 1, data.Series[0].Pos)
+	require.Equal(t, []float64{70_001, 80_001, 90_001}, data.Series[0].Values)
+
+	// growing the window sends only the newly visible range
+	data = handle(Control{Op: "setWindow", WindowSize: 50_000})
+	require.Len(t, data.Series, 2)
+	for _, s := range data.Series {
+		require.Equal(t, []int64{50_000, 60_000}, s.Timestamps)
+	}
+
+	// shrinking it sends nothing
+	require.Nil(t, handle(Control{Op: "setWindow", WindowSize: 10_000}))
+
+	data = handle(Control{Op: "history", Start: "0", End: "20000", Positions: []int{1}})
+	require.Len(t, data.Series, 1)
+	require.Equal(t, []int64{0, 10_000}, data.Series[0].Timestamps)
+
+	require.Nil(t, handle(Control{Op: "removeSeries", Positions: []int{0}}))
+	require.Equal(t, map[string][]int{"b": {1}}, sub.inputMap())
+	require.Error(t, sub.handleControl(db, Control{Op: "removeSeries", Positions: []int{0}}, outMsg, now))
+
+	// later additions never reuse removed positions
+	data = handle(Control{Op: "addSeries", Series: []string{"a"}})
+	require.Equal(t, 2, data.Series[0].Pos)
+
+	require.Error(t, sub.handleControl(db, Control{Op: "addSeries", Series: []string{"a | nope"}}, outMsg, now))
+	require.Len(t, sub.nodes, 3)
+
+	// data is held while paused and delivered on resume
+	require.Nil(t, handle(Control{Op: "pause"}))
+	sub.hold(&messages.Data{Series: []messages.Series{{Pos: 1, Timestamps: []int64{1}, Values: []float64{1}}}})
+	sub.hold(&messages.Data{Series: []messages.Series{{Pos: 1, Timestamps: []int64{2}, Values: []float64{2}}}})
+	data = handle(Control{Op: "resume"})
+	require.Equal(t, []messages.Series{{Pos: 1, Timestamps: []int64{1, 2}, Values: []float64{1, 2}}}, data.Series)
+}
+
+func newSubscription(parser *computed_series.Parser, req *Request, now time.Time) (*Subscription, error) {
+	rng, err := req.Range(now)
+	if err != nil {
+		return nil, err
+	}
+	return NewRangeSubscription(parser, req, rng)
+}
+
+func TestRunStopsAtEnd(t *testing.T) {
+	br := broker.NewBroker()
+	go br.Start()
+	defer br.Stop()
+
+	db := inmem.NewBackend()
+	req := &Request{
+		Series: []string{"a"},
+		From:   "-1h",
+		To:     "now+50ms",
+	}
+	start := req.Start(time.Now())
+	sub, err := NewSubscription(computed_series.NewParser(), req, start)
+	require.NoError(t, err)
+
+	msgCh := make(chan *messages.Data, 10)
+	done := make(chan struct{})
+	go func() {
+		sub.Run(db, br, msgCh, start)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after the end of the range")
+	}
+}
+
+func TestPauseOverflow(t *testing.T) {
+	now := time.UnixMilli(100_000)
+
+	db := inmem.NewBackend()
+	require.NoError(t, db.InsertSeries(schema.Series{SeriesName: "a", Values: []schema.Value{
+		{Timestamp: time.UnixMilli(95_000), Value: 1},
+		{Timestamp: time.UnixMilli(96_000), Value: 2},
+	}}))
+
+	sub, err := newSubscription(computed_series.NewParser(), &Request{
+		Series:     []string{"a"},
+		WindowSize: 10_000,
+	}, now)
+	require.NoError(t, err)
+
+	outMsg := make(chan *messages.Data, 10)
+	require.NoError(t, sub.handleControl(db, Control{Op: "pause"}, outMsg, now))
+
+	// more than the buffer holds, stamped over the stored points
+	big := messages.Series{Pos: 0}
+	for i := 0; i <= maxPendingPoints; i++ {
+		big.Timestamps = append(big.Timestamps, 95_000)
+		big.Values = append(big.Values, 0)
+	}
+	big.Timestamps[len(big.Timestamps)-1] = 96_000
+	sub.hold(&messages.Data{Series: []messages.Series{big}})
+	require.Zero(t, sub.pendingPoints)
+	require.Empty(t, sub.pending.Series)
+
+	sub.hold(&messages.Data{Series: []messages.Series{{Pos: 0, Timestamps: []int64{96_000, 97_000}, Values: []float64{2, 3}}}})
+
+	require.NoError(t, sub.handleControl(db, Control{Op: "resume"}, outMsg, now))
+	require.Len(t, outMsg, 2)
+
+	reloaded := <-outMsg
+	require.Equal(t, []messages.Series{{Pos: 0, Timestamps: []int64{95_000, 96_000}, Values: []float64{1, 2}}}, reloaded.Series)
+
+	held := <-outMsg
+	require.Equal(t, []messages.Series{{Pos: 0, Timestamps: []int64{97_000}, Values: []float64{3}}}, held.Series)
+}
+
+func TestSeams(t *testing.T) {
+	now := time.UnixMilli(100_000)
+
+	db := inmem.NewBackend()
+	var values []schema.Value
+	for ms := int64(0); ms < 100_000; ms += 10_000 {
+		values = append(values, schema.Value{Timestamp: time.UnixMilli(ms), Value: float64(ms)})
+	}
+	require.NoError(t, db.InsertSeries(schema.Series{SeriesName: "a", Values: values}))
+
+	sub, err := newSubscription(computed_series.NewParser(), &Request{
+		Series:     []string{"a"},
+		WindowSize: 30_000,
+	}, now)
+	require.NoError(t, err)
+	_, err = sub.getInitialData(db, now)
+	require.NoError(t, err)
+
+	// live values already in the loaded history are dropped
+	live := []schema.Value{
+		{Timestamp: time.UnixMilli(90_000), Value: 90_000},
+		{Timestamp: time.UnixMilli(100_000), Value: 100_000},
+	}
+	require.Equal(t, live[1:], sub.afterLoaded(0, "a", live))
+
+	// history stops where the live range starts
+	outMsg := make(chan *messages.Data, 10)
+	require.NoError(t, sub.handleControl(db, Control{Op: "history", Start: "50000", End: "100000"}, outMsg, now))
+	data := <-outMsg
+	require.Equal(t, []int64{50_000, 60_000}, data.Series[0].Timestamps)
+}
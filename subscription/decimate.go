@@ -0,0 +1,152 @@
+package subscription
+
+import (
+	"github.com/minor-industries/rtgraph/messages"
+	"github.com/pkg/errors"
+	"math"
+)
+
+const (
+	decimateLTTB   = "lttb"
+	decimateMinMax = "minmax"
+)
+
+// minBudget is the smallest budget that keeps the first and last point and
+// something in between
+const minBudget = 3
+
+func validDecimation(method string, maxPoints int) error {
+	if maxPoints < 0 || (maxPoints > 0 && maxPoints < minBudget) {
+		return errors.Errorf("maxPoints must be zero or at least %d, got %d", minBudget, maxPoints)
+	}
+
+	switch method {
+	case "", decimateLTTB, decimateMinMax:
+		return nil
+	default:
+		return errors.Errorf("unknown decimation %q", method)
+	}
+}
+
+// decimate reduces s to at most maxPoints points, a maxPoints of zero disables
+// decimation. Smaller budgets than minBudget are rejected by validDecimation.
+func decimate(s messages.Series, maxPoints int, method string) messages.Series {
+	if maxPoints <= 0 || len(s.Timestamps) <= maxPoints {
+		return s
+	}
+
+	if method == decimateMinMax {
+		return minMax(s, maxPoints)
+	}
+	return lttb(s, maxPoints)
+}
+
+// lttb implements Largest-Triangle-Three-Buckets (Steinarsson, 2013). The first
+// and last points are kept; from each bucket in between it keeps the point
+// forming the largest triangle with the previously kept point and the average
+// of the next bucket.
+func lttb(s messages.Series, threshold int) messages.Series {
+	n := len(s.Timestamps)
+	if n <= threshold || threshold < minBudget {
+		return s
+	}
+
+	result := messages.Series{
+		Pos:        s.Pos,
+		Timestamps: make([]int64, 0, threshold),
+		Values:     make([]float64, 0, threshold),
+	}
+
+	keep := func(i int) {
+		result.Timestamps = append(result.Timestamps, s.Timestamps[i])
+		result.Values = append(result.Values, s.Values[i])
+	}
+
+	// bucket size for everything except the first and last point
+	every := float64(n-2) / float64(threshold-2)
+
+	a := 0
+	keep(a)
+
+	for i := 0; i < threshold-2; i++ {
+		// average of the next bucket
+		nextLo := int(float64(i+1)*every) + 1
+		nextHi := min(int(float64(i+2)*every)+1, n)
+		var avgX, avgY float64
+		for j := nextLo; j < nextHi; j++ {
+			avgX += float64(s.Timestamps[j])
+			avgY += s.Values[j]
+		}
+		count := float64(nextHi - nextLo)
+		avgX /= count
+		avgY /= count
+
+		lo := int(float64(i)*every) + 1
+		hi := int(float64(i+1)*every) + 1
+
+		ax, ay := float64(s.Timestamps[a]), s.Values[a]
+		maxArea := -1.0
+		next := lo
+		for j := lo; j < hi; j++ {
+			area := math.Abs((ax-avgX)*(s.Values[j]-ay) - (ax-float64(s.Timestamps[j]))*(avgY-ay))
+			if area > maxArea {
+				maxArea = area
+				next = j
+			}
+		}
+
+		keep(next)
+		a = next
+	}
+
+	keep(n - 1)
+	return result
+}
+
+// minMax keeps the lowest and highest point of each bucket, in time order
+func minMax(s messages.Series, maxPoints int) messages.Series {
+	n := len(s.Timestamps)
+	buckets := max(maxPoints/2, 1)
+
+	result := messages.Series{
+		Pos:        s.Pos,
+		Timestamps: make([]int64, 0, 2*buckets),
+		Values:     make([]float64, 0, 2*buckets),
+	}
+
+	keep := func(i int) {
+		result.Timestamps = append(result.Timestamps, s.Timestamps[i])
+		result.Values = append(result.Values, s.Values[i])
+	}
+
+	for b := 0; b < buckets; b++ {
+		lo := b * n / buckets
+		hi := (b + 1) * n / buckets
+		if lo >= hi {
+			continue
+		}
+
+		iMin, iMax := lo, lo
+		for j := lo + 1; j < hi; j++ {
+			if s.Values[j] < s.Values[iMin] {
+				iMin = j
+			}
+			if s.Values[j] > s.Values[iMax] {
+				iMax = j
+			}
+		}
+
+		switch {
+		case iMin == iMax:
+			keep(iMin)
+		case iMin < iMax:
+			keep(iMin)
+			keep(iMax)
+		default:
+			keep(iMax)
+			keep(iMin)
+		}
+	}
+
+	return result
+}
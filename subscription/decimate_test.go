@@ -0,0 +1,59 @@
+package subscription
+
+import (
+	"github.com/minor-industries/rtgraph/messages"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func sine(n int) messages.Series {
+	s := messages.Series{Pos: 2}
+	for i := 0; i < n; i++ {
+		s.Timestamps = append(s.Timestamps, int64(i*100))
+		s.Values = append(s.Values, math.Sin(float64(i)/50))
+	}
+	// a single spike that decimation should keep
+	s.Values[n/3] = 10
+	return s
+}
+
+func TestDecimate(t *testing.T) {
+	s := sine(10_000)
+
+	for _, method := range []string{decimateLTTB, decimateMinMax} {
+		t.Run(method, func(t *testing.T) {
+			d := decimate(s, 500, method)
+			require.Equal(t, 2, d.Pos)
+			require.LessOrEqual(t, len(d.Timestamps), 500)
+			require.Greater(t, len(d.Timestamps), 400)
+			require.Len(t, d.Values, len(d.Timestamps))
+			require.IsIncreasing(t, d.Timestamps)
+			require.Contains(t, d.Values, 10.0)
+		})
+	}
+
+	lttbResult := decimate(s, 500, "")
+	require.Equal(t, s.Timestamps[0], lttbResult.Timestamps[0])
+	require.Equal(t, s.Timestamps[len(s.Timestamps)-1], lttbResult.Timestamps[len(lttbResult.Timestamps)-1])
+
+	// short series and a zero budget are left alone
+	require.Equal(t, s, decimate(s, 0, ""))
+	short := sine(100)
+	require.Equal(t, short, decimate(short, 500, ""))
+
+	require.Error(t, validDecimation("bogus", 0))
+	for _, maxPoints := range []int{-1, 1, 2} {
+		require.Error(t, validDecimation("", maxPoints), maxPoints)
+	}
+
+	// the smallest budget is kept by both methods
+	require.NoError(t, validDecimation(decimateMinMax, 3))
+	for _, method := range []string{decimateLTTB, decimateMinMax} {
+		for maxPoints := 3; maxPoints <= 5; maxPoints++ {
+			d := decimate(s, maxPoints, method)
+			require.LessOrEqual(t, len(d.Timestamps), maxPoints, method)
+			require.NotEmpty(t, d.Timestamps, method)
+		}
+	}
+}
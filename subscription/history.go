@@ -0,0 +1,126 @@
+package subscription
+
+import (
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/minor-industries/rtgraph/storage"
+	"time"
+)
+
+// minHistoryPoints is the number of buckets a rollup tier must provide over the
+// requested span before it is used in place of raw samples
+const minHistoryPoints = 1000
+
+// rollupResolution picks the coarsest rollup tier that still gives at least
+// minHistoryPoints buckets over span. A zero resolution means raw samples.
+func rollupResolution(db storage.StorageBackend, span time.Duration) (storage.RollupBackend, time.Duration) {
+	rb, ok := db.(storage.RollupBackend)
+	if !ok {
+		return nil, 0
+	}
+
+	var best time.Duration
+	for _, res := range rb.RollupResolutions() {
+		if res > best && span/res >= minHistoryPoints {
+			best = res
+		}
+	}
+
+	return rb, best
+}
+
+// floorTime rounds t down to an epoch aligned multiple of res, like rollup buckets
+func floorTime(t time.Time, res time.Duration) time.Time {
+	ms, r := t.UnixMilli(), res.Milliseconds()
+	rem := ms % r
+	if rem < 0 {
+		rem += r
+	}
+	return time.UnixMilli(ms - rem)
+}
+
+func ceilTime(t time.Time, res time.Duration) time.Time {
+	floor := floorTime(t, res)
+	if floor.Before(t) {
+		return floor.Add(res)
+	}
+	return floor
+}
+
+// loadHistoryBetween loads values in [start, end). Rollups are only used when
+// useRollups is set, since bucket averages are not samples that operators can
+// work with.
+func loadHistoryBetween(
+	db storage.StorageBackend,
+	seriesName string,
+	start time.Time,
+	end time.Time,
+	useRollups bool,
+) (schema.Series, error) {
+	if rb, res := rollupResolution(db, end.Sub(start)); useRollups && res > 0 {
+		return loadRollupHistory(db, rb, seriesName, res, start, end, false)
+	}
+	return db.LoadDataBetween(seriesName, start, end)
+}
+
+// loadHistoryAfter loads values from start, including any after now
+func loadHistoryAfter(
+	db storage.StorageBackend,
+	seriesName string,
+	start time.Time,
+	now time.Time,
+	useRollups bool,
+) (schema.Series, error) {
+	if rb, res := rollupResolution(db, now.Sub(start)); useRollups && res > 0 {
+		return loadRollupHistory(db, rb, seriesName, res, start, now, true)
+	}
+	return db.LoadDataAfter(seriesName, start)
+}
+
+// loadRollupHistory uses rollups for the buckets that lie entirely within
+// [start, end) and raw samples for the partial buckets at either edge. The
+// bucket straddling start is not lost, and the newest bucket, still filling
+// up, is made of the same raw samples that follow it live.
+func loadRollupHistory(
+	db storage.StorageBackend,
+	rb storage.RollupBackend,
+	seriesName string,
+	res time.Duration,
+	start time.Time,
+	end time.Time,
+	openEnded bool,
+) (schema.Series, error) {
+	lo, hi := ceilTime(start, res), floorTime(end, res)
+
+	loadTail := func(from time.Time) (schema.Series, error) {
+		if openEnded {
+			return db.LoadDataAfter(seriesName, from)
+		}
+		return db.LoadDataBetween(seriesName, from, end)
+	}
+
+	if !lo.Before(hi) {
+		return loadTail(start)
+	}
+
+	head, err := db.LoadDataBetween(seriesName, start, lo)
+	if err != nil {
+		return schema.Series{}, err
+	}
+
+	buckets, err := rb.LoadRollupBetween(seriesName, res, lo, hi)
+	if err != nil {
+		return schema.Series{}, err
+	}
+
+	tail, err := loadTail(hi)
+	if err != nil {
+		return schema.Series{}, err
+	}
+
+	values := make([]schema.Value, 0, len(head.Values)+len(buckets.Values)+len(tail.Values))
+	values = append(values, head.Values...)
+	values = append(values, buckets.Values...)
+	values = append(values, tail.Values...)
+
+	return schema.Series{SeriesName: seriesName, Values: values}, nil
+}
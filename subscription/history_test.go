@@ -0,0 +1,105 @@
+package subscription
+
+import (
+	"github.com/minor-industries/rtgraph/computed_series"
+	"github.com/minor-industries/rtgraph/database/inmem"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// rollupBackend serves a bucket of value -1 for every minute
+type rollupBackend struct {
+	*inmem.Backend
+}
+
+func (b rollupBackend) RollupResolutions() []time.Duration {
+	return []time.Duration{time.Minute}
+}
+
+func (b rollupBackend) LoadRollupAfter(seriesName string, res time.Duration, start time.Time) (schema.Series, error) {
+	panic("not used")
+}
+
+func (b rollupBackend) LoadRollupBetween(seriesName string, res time.Duration, start, end time.Time) (schema.Series, error) {
+	result := schema.Series{SeriesName: seriesName}
+	for ts := start; ts.Before(end); ts = ts.Add(res) {
+		result.Values = append(result.Values, schema.Value{Timestamp: ts, Value: -1})
+	}
+	return result, nil
+}
+
+func TestRollupHistoryEdges(t *testing.T) {
+	db := rollupBackend{inmem.NewBackend()}
+
+	t0 := time.UnixMilli(0)
+	start := t0.Add(30 * time.Second)
+	now := t0.Add(1000*time.Minute + 30*time.Second)
+	hi := t0.Add(1000 * time.Minute)
+
+	raw := []schema.Value{
+		{Timestamp: start.Add(10 * time.Second), Value: 1}, // in the bucket straddling start
+		{Timestamp: hi.Add(10 * time.Second), Value: 2},    // in the newest, partial bucket
+		{Timestamp: hi.Add(20 * time.Second), Value: 3},
+	}
+	require.NoError(t, db.InsertSeries(schema.Series{SeriesName: "x", Values: raw}))
+
+	for _, bounded := range []bool{false, true} {
+		var series schema.Series
+		var err error
+		if bounded {
+			series, err = loadHistoryBetween(db, "x", start, now, true)
+		} else {
+			series, err = loadHistoryAfter(db, "x", start, now, true)
+		}
+		require.NoError(t, err)
+
+		values := series.Values
+		require.Len(t, values, 999+3)
+		require.Equal(t, raw[0], values[0])
+		require.Equal(t, schema.Value{Timestamp: t0.Add(time.Minute), Value: -1}, values[1])
+		require.Equal(t, schema.Value{Timestamp: hi.Add(-time.Minute), Value: -1}, values[999])
+		require.Equal(t, raw[1:], values[1000:])
+	}
+
+	series, err := loadHistoryAfter(db, "x", start, now, false)
+	require.NoError(t, err)
+	require.Equal(t, raw, series.Values)
+}
+
+func TestRollupsOnlyForInputs(t *testing.T) {
+	parser := computed_series.NewParser()
+	for expr, want := range map[string]bool{
+		"x":               true,
+		"x | avg 30s":     false,
+		"x | count 1h":    false,
+		"x + y":           false,
+		"x | convert C F": false,
+	} {
+		node, err := parser.ParseNode(expr, time.UnixMilli(1))
+		require.NoError(t, err, expr)
+		require.Equal(t, want, computed_series.IsInput(node), expr)
+	}
+}
+
+func TestFeedHistoryInterleaves(t *testing.T) {
+	node, err := computed_series.NewParser().ParseNode("a + b", time.Time{})
+	require.NoError(t, err)
+
+	// longer than a combining node buffers per input
+	const n = 25_000
+	windows := map[string][]schema.Value{}
+	for i := 0; i < n; i++ {
+		ts := time.UnixMilli(int64(i) * 1000)
+		windows["a"] = append(windows["a"], schema.Value{Timestamp: ts, Value: 1})
+		windows["b"] = append(windows["b"], schema.Value{Timestamp: ts, Value: 2})
+	}
+
+	result, err := feedHistory(node, func(seriesName string) (schema.Series, error) {
+		return schema.Series{SeriesName: seriesName, Values: windows[seriesName]}, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, result, n)
+	require.Equal(t, 3.0, result[0].Value)
+}
@@ -0,0 +1,63 @@
+package subscription
+
+import (
+	"github.com/minor-industries/rtgraph/computed_series"
+	"github.com/minor-industries/rtgraph/database/inmem"
+	"github.com/minor-industries/rtgraph/schema"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestConvertedMetadata(t *testing.T) {
+	db := inmem.NewBackend()
+
+	lo, hi := 0.0, 100.0
+	require.NoError(t, db.SetMetadata("temp", schema.SeriesMetadata{
+		Unit: "C", Min: &lo, Max: &hi, Color: "red",
+	}))
+
+	parser := computed_series.NewParser()
+	parser.SetUnitLookup(func(seriesName string) (string, error) {
+		md, err := db.LoadMetadata(seriesName)
+		return md.Unit, err
+	})
+
+	now := time.UnixMilli(100_000)
+	sub, err := newSubscription(parser, &Request{
+		Series:     []string{"temp", "temp | convert F", "temp | convert C furlong"},
+		WindowSize: 30_000,
+	}, now)
+	require.Error(t, err)
+
+	sub, err = newSubscription(parser, &Request{
+		Series:     []string{"temp", "temp | convert F"},
+		WindowSize: 30_000,
+	}, now)
+	require.NoError(t, err)
+
+	md, err := sub.loadMetadata(db, sub.allPositions())
+	require.NoError(t, err)
+	require.Len(t, md, 2)
+
+	require.Equal(t, "C", md[0].Unit)
+	require.Equal(t, 100.0, *md[0].Max)
+
+	require.Equal(t, "F", md[1].Unit)
+	require.Equal(t, "red", md[1].Color)
+	require.InDelta(t, 32, *md[1].Min, 1e-9)
+	require.InDelta(t, 212, *md[1].Max, 1e-9)
+
+	// offsets apply to the range
+	sub, err = newSubscription(parser, &Request{
+		Series:     []string{`temp | convert "°C" K`},
+		WindowSize: 30_000,
+	}, now)
+	require.NoError(t, err)
+
+	md, err = sub.loadMetadata(db, sub.allPositions())
+	require.NoError(t, err)
+	require.Equal(t, "K", md[0].Unit)
+	require.InDelta(t, 273.15, *md[0].Min, 1e-9)
+	require.InDelta(t, 373.15, *md[0].Max, 1e-9)
+}
@@ -1,30 +1,230 @@
 package subscription
 
-import "time"
+import (
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Request struct {
 	Series      []string `json:"series"`
 	WindowSize  uint64   `json:"windowSize"`
 	LastPointMs uint64   `json:"lastPointMs"`
 	Date        string   `json:"date"`
+	MarkerTypes []string `json:"markerTypes"`
+
+	// From and To select an explicit range, see TimeSpec for accepted forms.
+	// Live data stops once To has passed, see Subscription.RunWithControl.
+	From TimeSpec `json:"start"`
+	To   TimeSpec `json:"end"`
+
+	// Timezone is an IANA name used for Date and for times without an offset,
+	// defaults to the server's local time
+	Timezone string `json:"timezone"`
+
+	// MaxPoints caps the number of points sent per series for history loads,
+	// zero sends every point. Decimation selects how points are picked,
+	// "lttb" (default) or "minmax".
+	MaxPoints  int    `json:"maxPoints"`
+	Decimation string `json:"decimation"`
+}
+
+// Range is the resolved time range of a request
+type Range struct {
+	Start time.Time
+	End   time.Time // zero when the range is open and keeps streaming
+}
+
+func (r Range) bounded() bool {
+	return !r.End.IsZero()
+}
+
+func (req *Request) location() (*time.Location, error) {
+	if req.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(req.Timezone)
+	return loc, errors.Wrap(err, "load timezone")
+}
+
+// dateRange returns the calendar day selected by Date
+func (req *Request) dateRange() (time.Time, time.Time, error) {
+	loc, err := req.location()
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	t0, err := time.ParseInLocation("2006-01-02", req.Date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrap(err, "parse date")
+	}
+	return t0, t0.AddDate(0, 0, 1), nil
+}
+
+func (req *Request) wantsMarker(markerType string) bool {
+	for _, t := range req.MarkerTypes {
+		if t == markerType {
+			return true
+		}
+	}
+	return false
 }
 
+// Start returns the start of Range(now), or the zero time when the request
+// does not resolve. Use Range to get the error and the end of the range.
 func (req *Request) Start(now time.Time) time.Time {
-	var windowStart time.Time
-	if req.WindowSize > 0 {
-		windowSize := time.Duration(req.WindowSize) * time.Millisecond
-		windowStart = now.Add(-windowSize)
-	} else {
-		windowStart = time.UnixMilli(0) // get "all" points if windowSize unset
+	rng, err := req.Range(now)
+	if err != nil {
+		return time.Time{}
+	}
+	return rng.Start
+}
+
+// Range resolves the request to absolute times. Date takes precedence over
+// Start and End; WindowSize applies when no start is given.
+func (req *Request) Range(now time.Time) (Range, error) {
+	var result Range
+
+	switch {
+	case req.Date != "":
+		t0, t1, err := req.dateRange()
+		if err != nil {
+			return Range{}, err
+		}
+		result = Range{Start: t0, End: t1}
+	default:
+		loc, err := req.location()
+		if err != nil {
+			return Range{}, err
+		}
+
+		if req.To != "" {
+			result.End, err = req.To.Resolve(now, loc)
+			if err != nil {
+				return Range{}, errors.Wrap(err, "end")
+			}
+		}
+
+		switch {
+		case req.From != "":
+			result.Start, err = req.From.Resolve(now, loc)
+			if err != nil {
+				return Range{}, errors.Wrap(err, "start")
+			}
+		case req.WindowSize > 0:
+			windowSize := time.Duration(req.WindowSize) * time.Millisecond
+			windowEnd := now
+			if result.bounded() {
+				windowEnd = result.End
+			}
+			result.Start = windowEnd.Add(-windowSize)
+		default:
+			result.Start = time.UnixMilli(0) // get "all" points if windowSize unset
+		}
+
+		if result.bounded() && !result.End.After(result.Start) {
+			return Range{}, errors.New("end must be after start")
+		}
 	}
 
 	if req.LastPointMs != 0 {
 		tStartAfter := time.UnixMilli(int64(req.LastPointMs + 1))
-		if tStartAfter.After(windowStart) {
+		if tStartAfter.After(result.Start) {
 			// only use if inside the start window
-			return tStartAfter
+			result.Start = tStartAfter
+		}
+	}
+
+	return result, nil
+}
+
+// TimeSpec is an absolute or relative point in time. Accepted forms are
+// milliseconds since the epoch, RFC 3339, "2006-01-02T15:04:05",
+// "2006-01-02 15:04", "2006-01-02", "now", and offsets from now such as
+// "-6h" or "now-30m". JSON numbers are read as milliseconds since the epoch,
+// fractions of a millisecond are truncated.
+type TimeSpec string
+
+func (ts *TimeSpec) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		*ts = ""
+		return nil
+	}
+
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		*ts = TimeSpec(unquoted)
+		return nil
+	}
+
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*ts = TimeSpec(s)
+		return nil
+	}
+
+	// fractional milliseconds, e.g. 1700000000123.4, are truncated
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.Abs(f) >= math.MaxInt64 {
+		return errors.Errorf("invalid time %s", s)
+	}
+	*ts = TimeSpec(strconv.FormatInt(int64(f), 10))
+	return nil
+}
+
+var absoluteLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func (ts TimeSpec) Resolve(now time.Time, loc *time.Location) (time.Time, error) {
+	s := strings.TrimSpace(string(ts))
+
+	if s == "now" {
+		return now, nil
+	}
+
+	if rel, ok := strings.CutPrefix(s, "now"); ok {
+		s = strings.TrimSpace(rel)
+	}
+
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		d, err := parseOffset(s)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "parse relative time %q", string(ts))
+		}
+		return now.Add(d), nil
+	}
+
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range absoluteLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
 		}
 	}
 
-	return windowStart
+	return time.Time{}, errors.Errorf("invalid time %q", string(ts))
+}
+
+// parseOffset is time.ParseDuration with support for whole days, e.g. "-7d"
+func parseOffset(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
 }
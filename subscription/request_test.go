@@ -0,0 +1,98 @@
+package subscription
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRequestRange(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	parse := func(s string) Request {
+		var req Request
+		require.NoError(t, json.Unmarshal([]byte(s), &req))
+		return req
+	}
+
+	tests := []struct {
+		name  string
+		req   string
+		start time.Time
+		end   time.Time
+	}{
+		{
+			name:  "window",
+			req:   `{"windowSize": 60000}`,
+			start: now.Add(-time.Minute),
+		},
+		{
+			name:  "all",
+			req:   `{}`,
+			start: time.UnixMilli(0),
+		},
+		{
+			name:  "relative",
+			req:   `{"start": "-6h", "end": "now-1h"}`,
+			start: now.Add(-6 * time.Hour),
+			end:   now.Add(-time.Hour),
+		},
+		{
+			name:  "days",
+			req:   `{"start": "-7d"}`,
+			start: now.AddDate(0, 0, -7),
+		},
+		{
+			name:  "absolute",
+			req:   `{"start": "2024-05-01T00:00:00Z", "end": 1714608000000}`,
+			start: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "fractional millis",
+			req:   `{"start": 1714521600000.9, "end": 1.7146080000004e12}`,
+			start: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "window before end",
+			req:   `{"end": "2024-05-02 00:00", "windowSize": 3600000, "timezone": "UTC"}`,
+			start: time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "date in timezone",
+			req:   `{"date": "2024-05-01", "timezone": "America/New_York"}`,
+			start: time.Date(2024, 5, 1, 4, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 5, 2, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "last point",
+			req:   `{"windowSize": 60000, "lastPointMs": 1717243190000}`,
+			start: time.UnixMilli(1717243190001),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := parse(tt.req)
+			rng, err := req.Range(now)
+			require.NoError(t, err)
+			require.True(t, tt.start.Equal(rng.Start), "start %s", rng.Start)
+			require.True(t, tt.end.Equal(rng.End), "end %s", rng.End)
+			require.True(t, rng.Start.Equal(req.Start(now)))
+		})
+	}
+
+	for _, bad := range []string{
+		`{"start": "yesterday"}`,
+		`{"start": "-1h", "end": "-2h"}`,
+		`{"date": "2024-05-01", "timezone": "Mars/Olympus"}`,
+	} {
+		req := parse(bad)
+		_, err := req.Range(now)
+		require.Error(t, err, bad)
+		require.True(t, req.Start(now).IsZero())
+	}
+}
@@ -7,117 +7,382 @@ import (
 	"github.com/minor-industries/rtgraph/schema"
 	"github.com/minor-industries/rtgraph/storage"
 	"github.com/pkg/errors"
+	"sort"
 	"time"
 )
 
 type Subscription struct {
-	// TODO: combine inputSeries, operators, lastSeen into struct
-	lastSeen    map[int]time.Time // for each position
-	inputSeries []string
-	operators   []computed_series.Operator
-	req         *Request
+	// TODO: combine nodes, loadedTail into struct
+	loadedTail map[int]map[string]time.Time // newest stored value of each input fed to a position
+	nodes      []computed_series.Node       // nil for removed positions
+	req        *Request
+	rng        Range
+	parser     *computed_series.Parser
+
+	paused        bool
+	pending       *messages.Data // live data held back while paused
+	pendingPoints int
+	resync        map[int]*span // held series data dropped to bound pending, reloaded on resume
+	resyncMarkers *span
 }
 
+// NewSubscription prepares a subscription from start, the end of the range
+// comes from req. Use NewRangeSubscription to resolve both ends at once.
 func NewSubscription(
 	parser *computed_series.Parser,
 	req *Request,
 	start time.Time,
 ) (*Subscription, error) {
+	rng, err := req.Range(time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "time range")
+	}
+	rng.Start = start
+
+	return NewRangeSubscription(parser, req, rng)
+}
+
+// NewRangeSubscription prepares a subscription to rng, usually req.Range(now)
+func NewRangeSubscription(
+	parser *computed_series.Parser,
+	req *Request,
+	rng Range,
+) (*Subscription, error) {
+	if err := validDecimation(req.Decimation, req.MaxPoints); err != nil {
+		return nil, err
+	}
+	start := rng.Start
+
 	sub := &Subscription{
-		req:         req,
-		lastSeen:    map[int]time.Time{},
-		operators:   make([]computed_series.Operator, len(req.Series)),
-		inputSeries: make([]string, len(req.Series)),
+		req:        req,
+		rng:        rng,
+		parser:     parser,
+		loadedTail: map[int]map[string]time.Time{},
+		nodes:      make([]computed_series.Node, len(req.Series)),
 	}
 
 	for idx, sn := range req.Series {
-		inputSeriesName, op, err := parser.Parse(sn, start)
+		node, err := parser.ParseNode(sn, start)
 		if err != nil {
 			return nil, errors.Wrap(err, "parse series")
 		}
-		sub.inputSeries[idx] = inputSeriesName
-		sub.operators[idx] = op
+		sub.nodes[idx] = node
 	}
 
 	return sub, nil
 }
 
+func (sub *Subscription) allPositions() []int {
+	var result []int
+	for idx, node := range sub.nodes {
+		if node != nil {
+			result = append(result, idx)
+		}
+	}
+	return result
+}
+
 func (sub *Subscription) getInitialData(
 	db storage.StorageBackend,
-	start time.Time,
+	now time.Time,
 ) (*messages.Data, error) {
-	allSeries := make([][]schema.Value, len(sub.operators))
-	for idx, op := range sub.operators {
-		var window schema.Series
-		var err error
-		if sub.req.Date != "" {
-			// TODO: should this handle more cases than just local time?
-			t0, err := time.ParseInLocation("2006-01-02", sub.req.Date, time.Local)
-			if err != nil {
-				return nil, errors.Wrap(err, "parse date")
+	positions := sub.allPositions()
+
+	series, err := sub.loadPositions(db, positions, now)
+	if err != nil {
+		return nil, err
+	}
+
+	markers, err := sub.loadMarkers(db, sub.rng.Start, sub.rng.End)
+	if err != nil {
+		return nil, errors.Wrap(err, "load markers")
+	}
+
+	metadata, err := sub.loadMetadata(db, positions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messages.Data{
+		Series:   series,
+		Markers:  markers,
+		Metadata: metadata,
+	}, nil
+}
+
+// loadPositions runs the live operators of the given positions over stored history
+func (sub *Subscription) loadPositions(
+	db storage.StorageBackend,
+	positions []int,
+	now time.Time,
+) ([]messages.Series, error) {
+	var result []messages.Series
+	for _, idx := range positions {
+		node := sub.nodes[idx]
+		from := sub.rng.Start.Add(-computed_series.Lookback(node))
+		useRollups := computed_series.IsInput(node)
+
+		tails := map[string]time.Time{}
+		sub.loadedTail[idx] = tails
+
+		series, err := feedHistory(node, func(seriesName string) (schema.Series, error) {
+			var window schema.Series
+			var err error
+			if sub.rng.bounded() {
+				window, err = loadHistoryBetween(db, seriesName, from, sub.rng.End, useRollups)
+			} else {
+				window, err = loadHistoryAfter(db, seriesName, from, now, useRollups)
 			}
-			t1 := t0.AddDate(0, 0, 1)
-			window, err = db.LoadDataBetween(sub.inputSeries[idx], t0, t1)
-		} else {
-			var lookback time.Duration = 0
-			if wo, ok := op.(computed_series.WindowedOperator); ok {
-				lookback = wo.Lookback()
+			if err == nil && len(window.Values) > 0 {
+				tails[seriesName] = window.Values[len(window.Values)-1].Timestamp
 			}
+			return window, err
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "load original window")
+		}
 
-			window, err = db.LoadDataAfter(
-				sub.inputSeries[idx],
-				start.Add(-lookback),
-			)
+		if msg, ok := seriesMessage(idx, series, time.Time{}, time.Time{}); ok {
+			result = append(result, decimate(msg, sub.req.MaxPoints, sub.req.Decimation))
 		}
+	}
+
+	return result, nil
+}
+
+// feedHistory runs the stored history of every input of node through it. The
+// inputs are fed interleaved in time, so nodes combining several inputs see
+// them as they would live and do not have to buffer one whole history.
+func feedHistory(
+	node computed_series.Node,
+	load func(seriesName string) (schema.Series, error),
+) ([]schema.Value, error) {
+	inputs := node.Inputs()
+	windows := make([][]schema.Value, len(inputs))
+	for i, name := range inputs {
+		window, err := load(name)
 		if err != nil {
-			return nil, errors.Wrap(err, "load original window")
+			return nil, err
+		}
+		windows[i] = window.Values
+	}
+
+	var result []schema.Value
+	for {
+		// the input with the earliest next value goes first, up to the next
+		// value of any other input
+		next := -1
+		for i, w := range windows {
+			if len(w) > 0 && (next < 0 || w[0].Timestamp.Before(windows[next][0].Timestamp)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return result, nil
+		}
+
+		var limit time.Time
+		bounded := false
+		for i, w := range windows {
+			if i != next && len(w) > 0 && (!bounded || w[0].Timestamp.Before(limit)) {
+				limit, bounded = w[0].Timestamp, true
+			}
 		}
 
-		series := op.ProcessNewValues(window.Values)
-		allSeries[idx] = series
+		w := windows[next]
+		n := len(w)
+		if bounded {
+			n = sort.Search(len(w), func(j int) bool { return w[j].Timestamp.After(limit) })
+		}
+
+		result = append(result, node.Process(inputs[next], w[:n])...)
+		windows[next] = w[n:]
 	}
+}
 
-	result := &messages.Data{}
+// seriesMessage converts values in [start, end) to a message, zero bounds are open
+func seriesMessage(
+	idx int,
+	series []schema.Value,
+	start time.Time,
+	end time.Time,
+) (messages.Series, bool) {
+	timestamps := make([]int64, 0, len(series))
+	values := make([]float64, 0, len(series))
 
-	for idx, series := range allSeries {
-		if len(series) == 0 {
+	for _, s := range series {
+		if !start.IsZero() && s.Timestamp.Before(start) {
 			continue
 		}
+		if !end.IsZero() && !s.Timestamp.Before(end) {
+			continue
+		}
+
+		timestamps = append(timestamps, s.Timestamp.UnixMilli())
+		values = append(values, s.Value)
+	}
 
-		timestamps := make([]int64, len(series))
-		values := make([]float64, len(series))
+	if len(timestamps) == 0 {
+		return messages.Series{}, false
+	}
+
+	return messages.Series{
+		Pos:        idx,
+		Timestamps: timestamps,
+		Values:     values,
+	}, true
+}
+
+func (sub *Subscription) loadMetadata(
+	db storage.StorageBackend,
+	positions []int,
+) ([]messages.Metadata, error) {
+	var result []messages.Metadata
 
-		for i, s := range series {
-			timestamps[i] = s.Timestamp.UnixMilli()
-			values[i] = s.Value
+	// metadata describes the input series, operators may not preserve it
+	// except for unit conversions
+	for _, idx := range positions {
+		inputs := sub.nodes[idx].Inputs()
+		if len(inputs) != 1 {
+			continue
 		}
 
-		result.Series = append(result.Series, messages.Series{
-			Pos:        idx,
-			Timestamps: timestamps,
-			Values:     values,
+		md, err := db.LoadMetadata(inputs[0])
+		if err != nil {
+			return nil, errors.Wrap(err, "load metadata")
+		}
+		if unit, ok := computed_series.OutputUnit(sub.nodes[idx]); ok {
+			md = convertMetadata(md, unit)
+		}
+		if md.IsZero() {
+			continue
+		}
+		result = append(result, messages.Metadata{
+			Pos:         idx,
+			Unit:        md.Unit,
+			Description: md.Description,
+			Min:         md.Min,
+			Max:         md.Max,
+			Color:       md.Color,
 		})
 	}
 
 	return result, nil
 }
 
+// convertMetadata changes the unit of md, converting its range when possible.
+// Min and Max are axis bounds rather than differences, so offsets apply: a
+// 0 to 100 °C range becomes 273.15 to 373.15 K.
+func convertMetadata(md schema.SeriesMetadata, unit string) schema.SeriesMetadata {
+	conv, err := computed_series.NewOpConvert(md.Unit, unit)
+	md.Unit = unit
+
+	convert := func(x *float64) *float64 {
+		if x == nil || err != nil {
+			return nil
+		}
+		v := conv.Convert(*x)
+		return &v
+	}
+	md.Min = convert(md.Min)
+	md.Max = convert(md.Max)
+
+	return md
+}
+
+// loadMarkers loads wanted markers from start, up to end if it is not zero
+func (sub *Subscription) loadMarkers(
+	db storage.StorageBackend,
+	start time.Time,
+	end time.Time,
+) ([]messages.Marker, error) {
+	if len(sub.req.MarkerTypes) == 0 {
+		return nil, nil
+	}
+
+	var markers []schema.Marker
+	var err error
+	if !end.IsZero() {
+		markers, err = db.LoadMarkersBetween(start, end)
+	} else {
+		markers, err = db.LoadMarkersAfter(start)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result []messages.Marker
+	for _, m := range markers {
+		if sub.req.wantsMarker(m.Type) {
+			result = append(result, markerMessage(m))
+		}
+	}
+	return result, nil
+}
+
+func markerMessage(m schema.Marker) messages.Marker {
+	return messages.Marker{
+		ID:        m.ID,
+		Type:      m.Type,
+		Ref:       m.Ref,
+		Timestamp: m.Timestamp.UnixMilli(),
+	}
+}
+
+// afterLoaded drops live values that are not newer than the history loaded
+// for a position. The storage writer lags the broker, so values published
+// around the time history was loaded may arrive both ways.
+func (sub *Subscription) afterLoaded(idx int, seriesName string, values []schema.Value) []schema.Value {
+	tail, ok := sub.loadedTail[idx][seriesName]
+	if !ok {
+		return values
+	}
+
+	result := make([]schema.Value, 0, len(values))
+	for _, v := range values {
+		if v.Timestamp.After(tail) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 func (sub *Subscription) inputMap() map[string][]int {
-	// output is map from input series names to indices into the sub.operators array
+	// output is map from input series names to indices into the sub.nodes array
 	result := map[string][]int{}
-	for idx, inName := range sub.inputSeries {
-		result[inName] = append(result[inName], idx)
+	for idx, node := range sub.nodes {
+		if node == nil {
+			continue
+		}
+		for _, inName := range node.Inputs() {
+			result[inName] = append(result[inName], idx)
+		}
 	}
 	return result
 }
 
+// Run sends the initial data, then streams live data until the end of the
+// range. It returns right away for ranges that have already ended. start is
+// unused, the range the subscription was created with applies.
 func (sub *Subscription) Run(
 	db storage.StorageBackend,
 	broker *broker.Broker,
 	msgCh chan *messages.Data,
 	start time.Time,
 ) {
-	initialData, err := sub.getInitialData(db, start)
+	sub.RunWithControl(db, broker, msgCh, nil)
+}
+
+// RunWithControl is Run with a channel of client control messages that change
+// the subscription while it streams. Control messages are still handled after
+// the end of the range, it returns once ctrlCh is closed.
+func (sub *Subscription) RunWithControl(
+	db storage.StorageBackend,
+	broker *broker.Broker,
+	msgCh chan *messages.Data,
+	ctrlCh <-chan Control,
+) {
+	initialData, err := sub.getInitialData(db, time.Now())
 	if err != nil {
 		msgCh <- &messages.Data{
 			Error: errors.Wrap(err, "get initial data").Error(),
@@ -126,76 +391,86 @@ func (sub *Subscription) Run(
 	}
 	msgCh <- initialData
 
-	sub.produceAllSeries(broker, msgCh)
+	sub.produceAllSeries(db, broker, msgCh, ctrlCh)
 }
 
 func (sub *Subscription) produceAllSeries(
+	db storage.StorageBackend,
 	broker *broker.Broker,
 	outMsg chan *messages.Data,
+	ctrlCh <-chan Control,
 ) {
-	var cutoffTime int64
-	if sub.req.Date != "" {
-		// if date given, we want to stop streaming points that are after this date
-		t, err := time.ParseInLocation("2006-01-02", sub.req.Date, time.Local)
-		if err != nil {
-			outMsg <- &messages.Data{
-				Error: errors.Wrap(err, "parse date").Error(),
-			}
-			close(outMsg)
-			return
+	msgCh := broker.Subscribe()
+	defer func() {
+		if msgCh != nil {
+			broker.Unsubscribe(msgCh)
 		}
-		t = t.AddDate(0, 0, 1)
-		cutoffTime = t.UnixMilli()
-	}
+	}()
 
-	msgCh := broker.Subscribe()
-	defer broker.Unsubscribe(msgCh)
+	var ended <-chan time.Time
+	if sub.rng.bounded() {
+		ended = time.After(time.Until(sub.rng.End))
+	}
 
 	computedMap := sub.inputMap()
 
-	for m := range msgCh {
-		msg, ok := m.(schema.Series)
-		if !ok {
+	for {
+		var m any
+		select {
+		case <-ended:
+			if ctrlCh == nil {
+				return
+			}
+			// nothing past the end is streamed, keep serving control messages
+			broker.Unsubscribe(msgCh)
+			msgCh = nil
+			ended = nil
 			continue
-		}
-
-		data := &messages.Data{}
-
-		if out, ok := computedMap[msg.SeriesName]; ok {
-			for _, idx := range out {
-				op := sub.operators[idx]
-				series := op.ProcessNewValues(msg.Values)
-
-				if len(series) == 0 {
-					continue
+		case m = <-msgCh:
+		case ctrl, ok := <-ctrlCh:
+			if !ok {
+				return
+			}
+			if err := sub.handleControl(db, ctrl, outMsg, time.Now()); err != nil {
+				outMsg <- &messages.Data{
+					Error: errors.Wrap(err, ctrl.Op).Error(),
 				}
+			}
+			computedMap = sub.inputMap()
+			continue
+		}
 
-				timestamps := make([]int64, 0, len(series))
-				values := make([]float64, 0, len(series))
+		// messages queued before the end was noticed may still hold later points
+		cutoff := sub.rng.End
 
-				for _, s := range series {
-					ts := s.Timestamp.UnixMilli()
-					if cutoffTime > 0 && ts >= cutoffTime {
-						continue
-					}
+		data := &messages.Data{}
 
-					timestamps = append(timestamps, ts)
-					values = append(values, s.Value)
-				}
+		switch msg := m.(type) {
+		case schema.Marker:
+			if !sub.req.wantsMarker(msg.Type) {
+				continue
+			}
+			if !cutoff.IsZero() && !msg.Timestamp.Before(cutoff) {
+				continue
+			}
+			data.Markers = []messages.Marker{markerMessage(msg)}
+		case schema.Series:
+			for _, idx := range computedMap[msg.SeriesName] {
+				series := sub.nodes[idx].Process(msg.SeriesName, sub.afterLoaded(idx, msg.SeriesName, msg.Values))
 
-				if len(timestamps) == 0 {
-					continue
+				if s, ok := seriesMessage(idx, series, time.Time{}, cutoff); ok {
+					data.Series = append(data.Series, s)
 				}
-
-				data.Series = append(data.Series, messages.Series{
-					Pos:        idx,
-					Timestamps: timestamps,
-					Values:     values,
-				})
 			}
+			if len(data.Series) == 0 {
+				continue
+			}
+		default:
+			continue
 		}
 
-		if len(data.Series) == 0 {
+		if sub.paused {
+			sub.hold(data)
 			continue
 		}
 